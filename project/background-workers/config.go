@@ -0,0 +1,74 @@
+package backgroundworkers
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type Config struct {
+	Redis RedisConfig
+
+	// Consumer is the name of this instance in the consumer groups.
+	// When empty, a random name is generated for every subscriber.
+	Consumer string
+	// BlockTime is how long a subscriber waits for new stream entries.
+	BlockTime time.Duration
+	// ClaimInterval is how often pending entries of other consumers are checked.
+	ClaimInterval time.Duration
+	// MaxIdleTime is how long an entry may stay pending before it can be
+	// claimed. Subscribers claim only their own entries delivered before
+	// they started, so it doesn't bound how long handlers may work.
+	MaxIdleTime time.Duration
+	// ConsumerTimeout is how long a consumer may not read its stream before
+	// its pending entries are reclaimed by live consumers. It must be longer
+	// than a handler can work on one message, retries included.
+	ConsumerTimeout time.Duration
+	// ReclaimInterval is how often entries of dead consumers are reclaimed.
+	ReclaimInterval time.Duration
+	// Partitions is how many streams ticket events are spread over, by the
+	// hash of the ticket ID. Every handler runs one instance per partition.
+	// Streams must be drained before it is changed, see eventbus.Partition.
+	Partitions int
+	// LegacyStreamsDrained stops consuming the streams ticket events were
+	// published to per event type, see eventbus.LegacyTopics. Set it once
+	// the consumer lag of their handlers is zero and nothing publishes there.
+	LegacyStreamsDrained bool
+	// ReceiptTTL is how long receipt numbers are kept to void the receipts
+	// of canceled bookings. Cancellations of bookings confirmed longer ago,
+	// or before receipts were first tracked, are skipped with a warning and
+	// don't void their receipts. A cancellation whose confirmation is not
+	// projected yet waits for its receipt, and goes to the poison queue if
+	// it isn't issued within the retry policy of void-receipt-handler.
+	ReceiptTTL time.Duration
+}
+
+type RedisConfig struct {
+	Addr     string
+	DB       int
+	Password string
+	// TLS enables TLS when set.
+	TLS      *tls.Config
+	PoolSize int
+}
+
+func (c RedisConfig) options() *redis.Options {
+	return &redis.Options{
+		Addr:      c.Addr,
+		DB:        c.DB,
+		Password:  c.Password,
+		TLSConfig: c.TLS,
+		PoolSize:  c.PoolSize,
+	}
+}
+
+// sharedClient lets publishers and subscribers share the Redis pool
+// without closing it, the worker closes it once all of them are closed.
+type sharedClient struct {
+	redis.UniversalClient
+}
+
+func (sharedClient) Close() error {
+	return nil
+}
@@ -0,0 +1,77 @@
+package backgroundworkers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CheckRunning returns an error when the router is not running.
+func (w *Worker) CheckRunning(ctx context.Context) error {
+	if w.router.IsClosed() {
+		return errors.New("router is closed")
+	}
+	if !w.router.IsRunning() {
+		return errors.New("router is not running yet")
+	}
+
+	return nil
+}
+
+// CheckConsumerLag returns an error when any consumer group has more than
+// maxLag entries not yet delivered to it.
+func (w *Worker) CheckConsumerLag(ctx context.Context, maxLag int64) error {
+	var lagging []string
+
+	for _, handler := range w.processor.Handlers() {
+		group := consumerGroups[handler.Name]
+
+		lag, err := w.consumerLag(ctx, handler.Topic, group, maxLag)
+		if err != nil {
+			return err
+		}
+		if lag > maxLag {
+			lagging = append(lagging, fmt.Sprintf("%s/%s lag is over %d", handler.Topic, group, maxLag))
+		}
+	}
+
+	if len(lagging) > 0 {
+		return errors.New(strings.Join(lagging, ", "))
+	}
+
+	return nil
+}
+
+// consumerLag counts entries after the last one delivered to the group, up to maxLag+1.
+// It doesn't rely on the XINFO lag field, which is not available before Redis 7.
+func (w *Worker) consumerLag(ctx context.Context, stream string, group string, maxLag int64) (int64, error) {
+	// The stream is created with its first entry or consumer group.
+	exists, err := w.rdb.Exists(ctx, stream).Result()
+	if err != nil {
+		return 0, fmt.Errorf("cannot check if %s exists: %w", stream, err)
+	}
+	if exists == 0 {
+		return 0, nil
+	}
+
+	groups, err := w.rdb.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return 0, fmt.Errorf("cannot get consumer groups of %s: %w", stream, err)
+	}
+
+	for _, g := range groups {
+		if g.Name != group {
+			continue
+		}
+
+		entries, err := w.rdb.XRangeN(ctx, stream, "("+g.LastDeliveredID, "+", maxLag+1).Result()
+		if err != nil {
+			return 0, fmt.Errorf("cannot read %s: %w", stream, err)
+		}
+
+		return int64(len(entries)), nil
+	}
+
+	return 0, nil
+}
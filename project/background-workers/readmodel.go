@@ -0,0 +1,145 @@
+package backgroundworkers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"tickets/eventbus"
+	"tickets/events"
+	"tickets/retry"
+	"time"
+
+	"github.com/ThreeDotsLabs/go-event-driven/common/log"
+	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/redis/go-redis/v9"
+)
+
+const replayBatchSize = 100
+
+type replayedEvent struct {
+	id          string
+	publishedAt time.Time
+	apply       func(ctx context.Context) error
+}
+
+// RebuildReadModel projects all events kept in the streams again, in the
+// order they were published. Projecting is idempotent by event ID, so the
+// read model isn't cleared and the projection keeps running meanwhile.
+func (w *Worker) RebuildReadModel(ctx context.Context) error {
+	handlers := []eventbus.EventHandler{
+		eventbus.On(w.projection.OnBookingConfirmed),
+		eventbus.On(w.projection.OnBookingCanceled),
+	}
+
+	var replayed []replayedEvent
+	for _, stream := range w.replayedStreams() {
+		streamEvents, err := readStream(ctx, w.rdb, stream, func(ctx context.Context, msg *message.Message) error {
+			return eventbus.Dispatch(ctx, w.upcasters, handlers, msg)
+		})
+		if err != nil {
+			return err
+		}
+		replayed = append(replayed, streamEvents...)
+	}
+
+	sort.SliceStable(replayed, func(i, j int) bool {
+		return replayed[i].publishedAt.Before(replayed[j].publishedAt)
+	})
+
+	for _, event := range replayed {
+		err := event.apply(ctx)
+		if retry.IsPermanent(err) {
+			log.FromContext(ctx).WithError(err).WithField("event_id", event.id).Warn("Skipping event which cannot be projected")
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot replay event %s: %w", event.id, err)
+		}
+	}
+
+	return nil
+}
+
+type replayedStream struct {
+	topic string
+	// eventName is the type of all events of the stream, for streams of a
+	// single type, whose older entries don't name it in the metadata.
+	eventName string
+}
+
+// replayedStreams returns the partitions of the stream of ticket events, and
+// the streams of every event type they were published to before, with and
+// without partitions.
+func (w *Worker) replayedStreams() []replayedStream {
+	var streams []replayedStream
+	for _, topic := range eventbus.PartitionTopics(eventbus.TopicFor[events.TicketBookingConfirmed](), w.partitions) {
+		streams = append(streams, replayedStream{topic: topic})
+	}
+
+	for _, eventName := range []string{
+		events.Name[events.TicketBookingConfirmed](),
+		events.Name[events.TicketBookingCanceled](),
+	} {
+		for _, topic := range eventbus.LegacyTopics(eventName, w.partitions) {
+			streams = append(streams, replayedStream{topic: topic, eventName: eventName})
+		}
+	}
+
+	return streams
+}
+
+// readStream reads every event in the stream, oldest first.
+func readStream(
+	ctx context.Context,
+	rdb redis.UniversalClient,
+	stream replayedStream,
+	handle func(ctx context.Context, msg *message.Message) error,
+) ([]replayedEvent, error) {
+	unmarshaller := redisstream.DefaultMarshallerUnmarshaller{}
+
+	var replayed []replayedEvent
+
+	start := "-"
+	for {
+		entries, err := rdb.XRangeN(ctx, stream.topic, start, "+", replayBatchSize).Result()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", stream.topic, err)
+		}
+
+		for _, entry := range entries {
+			msg, err := unmarshaller.Unmarshal(entry.Values)
+			if err != nil {
+				return nil, fmt.Errorf("cannot unmarshal %s entry %s: %w", stream.topic, entry.ID, err)
+			}
+			if stream.eventName != "" && msg.Metadata.Get(eventbus.EventNameMetadata) == "" {
+				msg.Metadata.Set(eventbus.EventNameMetadata, stream.eventName)
+			}
+
+			var envelope struct {
+				Header events.Header `json:"header"`
+			}
+			err = json.Unmarshal(msg.Payload, &envelope)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode %s entry %s: %w", stream.topic, entry.ID, err)
+			}
+
+			// Events with an invalid timestamp sort first, the projection skips them anyway.
+			publishedAt, _ := time.Parse(time.RFC3339Nano, envelope.Header.PublishedAt)
+
+			replayed = append(replayed, replayedEvent{
+				id:          envelope.Header.Id,
+				publishedAt: publishedAt,
+				apply: func(ctx context.Context) error {
+					return handle(ctx, msg)
+				},
+			})
+		}
+
+		if len(entries) < replayBatchSize {
+			return replayed, nil
+		}
+		start = "(" + entries[len(entries)-1].ID
+	}
+}
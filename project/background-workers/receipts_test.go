@@ -0,0 +1,236 @@
+package backgroundworkers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"tickets/clients"
+	"tickets/events"
+	"tickets/metrics"
+	"tickets/money"
+	"tickets/readmodel"
+	"tickets/receipts"
+	"time"
+
+	commonClients "github.com/ThreeDotsLabs/go-event-driven/common/clients"
+	receiptsAPI "github.com/ThreeDotsLabs/go-event-driven/common/clients/receipts"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeReceiptsServer struct {
+	mu      sync.Mutex
+	issued  map[string]receiptsAPI.Receipt
+	voided  []receiptsAPI.VoidReceiptRequest
+	voidErr int
+}
+
+func (f *fakeReceiptsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/void-receipt"):
+		req := receiptsAPI.VoidReceiptRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if f.voidErr != 0 {
+			w.WriteHeader(f.voidErr)
+			return
+		}
+
+		f.voided = append(f.voided, req)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/receipts"):
+		req := receiptsAPI.CreateReceipt{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		status := http.StatusOK
+		receipt, ok := f.issued[*req.IdempotencyKey]
+		if !ok {
+			status = http.StatusCreated
+			receipt = receiptsAPI.Receipt{
+				Number:   "R-" + req.TicketId,
+				IssuedAt: time.Now(),
+				Price:    req.Price,
+				TicketId: req.TicketId,
+			}
+			f.issued[*req.IdempotencyKey] = receipt
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(receipt)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+type memoryReceiptStore struct {
+	mu       sync.Mutex
+	receipts map[string]string
+	// trackedSince is when receipts were first tracked.
+	trackedSince time.Time
+}
+
+func (s *memoryReceiptStore) Save(ctx context.Context, ticketID string, receiptNumber string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.receipts[ticketID] = receiptNumber
+	return nil
+}
+
+func (s *memoryReceiptStore) Get(ctx context.Context, ticketID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	number, ok := s.receipts[ticketID]
+	if !ok {
+		return "", receipts.ErrNotFound
+	}
+	return number, nil
+}
+
+func (s *memoryReceiptStore) Kept(ctx context.Context, confirmedAt time.Time) (bool, error) {
+	return !confirmedAt.Before(s.trackedSince), nil
+}
+
+func newReceiptsWorker(t *testing.T, server *fakeReceiptsServer) (*Worker, *memoryReceiptStore) {
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	c, err := commonClients.NewClients(httpServer.URL, nil)
+	require.NoError(t, err)
+
+	store := &memoryReceiptStore{receipts: map[string]string{}}
+
+	repo := readmodel.NewMemoryRepository()
+
+	return &Worker{
+		receiptsClient: clients.NewReceiptsClient(c, metrics.New(prometheus.NewRegistry()), nil),
+		receipts:       store,
+		readModel:      repo,
+		projection:     readmodel.NewProjection(repo),
+	}, store
+}
+
+func TestVoidReceipt(t *testing.T) {
+	server := &fakeReceiptsServer{issued: map[string]receiptsAPI.Receipt{}}
+	w, store := newReceiptsWorker(t, server)
+	ctx := context.Background()
+
+	price, err := money.New("49.90", "EUR")
+	require.NoError(t, err)
+
+	confirmed := &events.TicketBookingConfirmed{
+		Header:   events.NewHeader[events.TicketBookingConfirmed](),
+		TicketId: "ticket-1",
+		Price:    price,
+	}
+	require.NoError(t, w.issueReceipt(ctx, confirmed))
+	// Redelivered confirmation gets the same receipt.
+	require.NoError(t, w.issueReceipt(ctx, confirmed))
+
+	number, err := store.Get(ctx, "ticket-1")
+	require.NoError(t, err)
+	assert.Equal(t, "R-ticket-1", number)
+
+	canceled := &events.TicketBookingCanceled{
+		Header:   events.NewHeader[events.TicketBookingCanceled](),
+		TicketId: "ticket-1",
+	}
+	require.NoError(t, w.voidReceipt(ctx, canceled))
+
+	require.Len(t, server.voided, 1)
+	assert.Equal(t, "ticket-1", server.voided[0].TicketId)
+	assert.Equal(t, "ticket booking canceled", server.voided[0].Reason)
+	assert.Equal(t, "void-receipt:"+canceled.Header.Id, *server.voided[0].IdempotentId)
+}
+
+func TestVoidReceipt_before_receipt_was_issued(t *testing.T) {
+	server := &fakeReceiptsServer{issued: map[string]receiptsAPI.Receipt{}}
+	w, _ := newReceiptsWorker(t, server)
+
+	err := w.voidReceipt(context.Background(), &events.TicketBookingCanceled{
+		Header:   events.NewHeader[events.TicketBookingCanceled](),
+		TicketId: "ticket-1",
+	})
+
+	assert.ErrorContains(t, err, "was not issued yet")
+	assert.Empty(t, server.voided)
+}
+
+func TestVoidReceipt_of_untracked_receipt(t *testing.T) {
+	testCases := []struct {
+		name        string
+		confirmedAt time.Time
+		wantSkipped bool
+	}{
+		{
+			name:        "confirmed_before_tracking",
+			confirmedAt: time.Now().Add(-time.Hour * 2),
+			wantSkipped: true,
+		},
+		{
+			// Its receipt may still be issued.
+			name:        "confirmed_since_tracking",
+			confirmedAt: time.Now(),
+			wantSkipped: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &fakeReceiptsServer{issued: map[string]receiptsAPI.Receipt{}}
+			w, store := newReceiptsWorker(t, server)
+			store.trackedSince = time.Now().Add(-time.Hour)
+			ctx := context.Background()
+
+			header := events.NewHeader[events.TicketBookingConfirmed]()
+			header.PublishedAt = tc.confirmedAt.Format(time.RFC3339Nano)
+			require.NoError(t, w.projection.OnBookingConfirmed(ctx, &events.TicketBookingConfirmed{
+				Header:   header,
+				TicketId: "ticket-1",
+			}))
+
+			err := w.voidReceipt(ctx, &events.TicketBookingCanceled{
+				Header:   events.NewHeader[events.TicketBookingCanceled](),
+				TicketId: "ticket-1",
+			})
+
+			if tc.wantSkipped {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, "was not issued yet")
+			}
+			assert.Empty(t, server.voided)
+		})
+	}
+}
+
+func TestVoidReceipt_rejected(t *testing.T) {
+	server := &fakeReceiptsServer{issued: map[string]receiptsAPI.Receipt{}, voidErr: http.StatusConflict}
+	w, store := newReceiptsWorker(t, server)
+	ctx := context.Background()
+
+	require.NoError(t, store.Save(ctx, "ticket-1", "R-ticket-1"))
+
+	err := w.voidReceipt(ctx, &events.TicketBookingCanceled{
+		Header:   events.NewHeader[events.TicketBookingCanceled](),
+		TicketId: "ticket-1",
+	})
+
+	assert.ErrorAs(t, err, &clients.ErrConflict{})
+	assert.ErrorContains(t, err, "R-ticket-1")
+}
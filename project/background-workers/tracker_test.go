@@ -0,0 +1,135 @@
+package backgroundworkers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"tickets/events"
+	"tickets/readmodel"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingAppender struct {
+	mu   sync.Mutex
+	rows map[string][][]string
+}
+
+func (r *recordingAppender) AppendRow(ctx context.Context, spreadsheetName string, row []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rows[spreadsheetName] = append(r.rows[spreadsheetName], row)
+	return nil
+}
+
+func TestTrackerFollowsTicketLifecycle(t *testing.T) {
+	confirmed := &events.TicketBookingConfirmed{Header: events.NewHeader[events.TicketBookingConfirmed](), TicketId: "ticket-1", CustomerEmail: "alice@example.com"}
+	canceled := &events.TicketBookingCanceled{Header: events.NewHeader[events.TicketBookingCanceled](), TicketId: "ticket-1", CustomerEmail: "alice@example.com"}
+	confirmedAgain := &events.TicketBookingConfirmed{Header: events.NewHeader[events.TicketBookingConfirmed](), TicketId: "ticket-1", CustomerEmail: "alice@example.com"}
+
+	project := map[string]func(ctx context.Context, p *readmodel.Projection) error{
+		"confirmed": func(ctx context.Context, p *readmodel.Projection) error { return p.OnBookingConfirmed(ctx, confirmed) },
+		"canceled":  func(ctx context.Context, p *readmodel.Projection) error { return p.OnBookingCanceled(ctx, canceled) },
+		"confirmed_again": func(ctx context.Context, p *readmodel.Projection) error {
+			return p.OnBookingConfirmed(ctx, confirmedAgain)
+		},
+	}
+	track := map[string]func(ctx context.Context, w *Worker) error{
+		"confirmed":       func(ctx context.Context, w *Worker) error { return w.bookingConfirmed(ctx, confirmed) },
+		"canceled":        func(ctx context.Context, w *Worker) error { return w.bookingCanceled(ctx, canceled) },
+		"confirmed_again": func(ctx context.Context, w *Worker) error { return w.bookingConfirmed(ctx, confirmedAgain) },
+	}
+
+	testCases := []struct {
+		name string
+		// projected are projected by the read model handler before they're tracked.
+		projected []string
+		tracked   []string
+		// wantPrinted and wantRefunded are the numbers of rows after each tracked event.
+		wantPrinted  []int
+		wantRefunded []int
+	}{
+		{
+			name:         "in_order",
+			tracked:      []string{"confirmed", "canceled", "confirmed_again"},
+			wantPrinted:  []int{1, 1, 1},
+			wantRefunded: []int{0, 1, 1},
+		},
+		{
+			// The cancellation is parked, its row is appended with the confirmation's.
+			name:         "cancel_first",
+			tracked:      []string{"canceled", "confirmed", "confirmed_again"},
+			wantPrinted:  []int{0, 1, 1},
+			wantRefunded: []int{0, 1, 1},
+		},
+		{
+			name:         "projected_before_tracked",
+			projected:    []string{"canceled", "confirmed", "confirmed_again"},
+			tracked:      []string{"canceled", "confirmed", "confirmed_again"},
+			wantPrinted:  []int{0, 1, 1},
+			wantRefunded: []int{0, 1, 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			repo := readmodel.NewMemoryRepository()
+			appender := &recordingAppender{rows: map[string][][]string{}}
+			w := &Worker{
+				spreadsheetsClient: appender,
+				readModel:          repo,
+				projection:         readmodel.NewProjection(repo),
+			}
+
+			for _, name := range tc.projected {
+				require.NoError(t, project[name](ctx, readmodel.NewProjection(repo)), name)
+			}
+
+			var printed, refunded []int
+			for _, name := range tc.tracked {
+				require.NoError(t, track[name](ctx, w), name)
+				printed = append(printed, len(appender.rows["tickets-to-print"]))
+				refunded = append(refunded, len(appender.rows["tickets-to-refund"]))
+			}
+
+			assert.Equal(t, tc.wantPrinted, printed)
+			assert.Equal(t, tc.wantRefunded, refunded)
+			assert.Equal(t, []string{"ticket-1", "alice@example.com"}, appender.rows["tickets-to-refund"][0][:2])
+		})
+	}
+}
+
+func TestTrackerSeesEventsProjectedByOtherInstances(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+
+	newInstance := func() (*Worker, *recordingAppender) {
+		rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { _ = rdb.Close() })
+
+		repo := readmodel.NewRedisRepository(rdb, "read-model")
+		appender := &recordingAppender{rows: map[string][][]string{}}
+
+		return &Worker{
+			spreadsheetsClient: appender,
+			readModel:          repo,
+			projection:         readmodel.NewProjection(repo),
+		}, appender
+	}
+
+	projecting, _ := newInstance()
+	tracking, appender := newInstance()
+
+	confirmed := &events.TicketBookingConfirmed{Header: events.NewHeader[events.TicketBookingConfirmed](), TicketId: "ticket-1"}
+
+	require.NoError(t, projecting.projection.OnBookingConfirmed(ctx, confirmed))
+	require.NoError(t, tracking.bookingConfirmed(ctx, confirmed))
+
+	assert.Len(t, appender.rows["tickets-to-print"], 1)
+}
@@ -2,10 +2,17 @@ package backgroundworkers
 
 import (
 	"context"
-	"encoding/json"
-	"os"
-	"os/signal"
+	"errors"
+	"fmt"
 	"tickets/clients"
+	"tickets/eventbus"
+	"tickets/events"
+	"tickets/metrics"
+	"tickets/ordering"
+	"tickets/outbox"
+	"tickets/readmodel"
+	"tickets/receipts"
+	"tickets/reclaim"
 	"tickets/tickets"
 	"time"
 
@@ -13,227 +20,520 @@ import (
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
 	"github.com/ThreeDotsLabs/watermill/message"
-	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
-	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"golang.org/x/sync/errgroup"
 )
 
+// RowAppender appends rows to spreadsheets, like clients.SpreadsheetsClient
+// or clients.RowBatcher.
+type RowAppender interface {
+	AppendRow(ctx context.Context, spreadsheetName string, row []string) error
+}
+
+// ReceiptStore tracks receipts issued for tickets, like receipts.Store.
+type ReceiptStore interface {
+	Save(ctx context.Context, ticketID string, receiptNumber string) error
+	Get(ctx context.Context, ticketID string) (string, error)
+	// Kept reports whether the receipt of a ticket confirmed at
+	// confirmedAt is kept, or will be once it's issued.
+	Kept(ctx context.Context, confirmedAt time.Time) (bool, error)
+}
+
 type Worker struct {
 	receiptsClient     clients.ReceiptsClient
-	spreadsheetsClient clients.SpreadsheetsClient
-
-	publisher *redisstream.Publisher
-	router    *message.Router
+	spreadsheetsClient RowAppender
+	receipts           ReceiptStore
+
+	readModel  readmodel.Repository
+	projection *readmodel.Projection
+	upcasters  *events.Upcasters
+
+	rdb         *redis.Client
+	publisher   message.Publisher
+	subscribers []message.Subscriber
+
+	bus        *eventbus.Bus
+	partitions int
+	processor  *eventbus.Processor
+	forwarder  *outbox.Forwarder
+	reclaimer  *reclaim.Reclaimer
+	router     *message.Router
 }
 
 type Message struct {
-	CorrelationId string
-	Ticket        tickets.Ticket
+	Ticket tickets.Ticket
 }
 
-func (w *Worker) issueReceiptHandler(msg *message.Message) error {
-	event := TicketEvent{}
-	err := json.Unmarshal(msg.Payload, &event)
+func (w *Worker) issueReceipt(ctx context.Context, event *events.TicketBookingConfirmed) error {
+	resp, err := w.receiptsClient.IssueReceipt(
+		ctx,
+		clients.IssueReceiptRequest{
+			TicketID:       event.TicketId,
+			Price:          event.Price,
+			IdempotencyKey: "issue-receipt:" + event.Header.Id,
+		})
 	if err != nil {
 		return err
 	}
 
-	err = w.receiptsClient.IssueReceipt(
-		msg.Context(),
-		clients.IssueReceiptRequest{
-			TicketID: event.TicketId,
-			Price: clients.Price{
-				Amount:   event.Price.Amount,
-				Currency: event.Price.Currency,
-			},
-		})
-	return err
+	return w.receipts.Save(ctx, event.TicketId, resp.ReceiptNumber)
 }
 
-func (w *Worker) bookingCanceled(msg *message.Message) error {
-	event := TicketEvent{}
-	err := json.Unmarshal(msg.Payload, &event)
+func (w *Worker) voidReceipt(ctx context.Context, event *events.TicketBookingCanceled) error {
+	receiptNumber, err := w.receipts.Get(ctx, event.TicketId)
+	if errors.Is(err, receipts.ErrNotFound) {
+		kept, err := w.receiptKept(ctx, event.TicketId)
+		if err != nil {
+			return err
+		}
+		if !kept {
+			log.FromContext(ctx).
+				WithField("ticket_id", event.TicketId).
+				Warn("Skipping cancellation, the receipt of its confirmation was not tracked or expired")
+			return nil
+		}
+
+		// The confirmation may still be processed, retry until its receipt is issued.
+		return fmt.Errorf("receipt of ticket %s was not issued yet", event.TicketId)
+	}
 	if err != nil {
 		return err
 	}
 
-	err = w.spreadsheetsClient.AppendRow(
-		msg.Context(),
-		"tickets-to-refund",
-		[]string{
-			event.TicketId,
-			event.CustomerEmail,
-			event.Price.Amount,
-			event.Price.Currency,
+	err = w.receiptsClient.VoidReceipt(
+		ctx,
+		clients.VoidReceiptRequest{
+			TicketID:       event.TicketId,
+			Reason:         "ticket booking canceled",
+			IdempotencyKey: "void-receipt:" + event.Header.Id,
 		})
+	if err != nil {
+		return fmt.Errorf("cannot void receipt %s: %w", receiptNumber, err)
+	}
 
-	return err
+	return nil
 }
 
-func (w *Worker) bookingConfirmed(msg *message.Message) error {
-	event := TicketEvent{}
-	err := json.Unmarshal(msg.Payload, &event)
+// receiptKept reports whether the receipt of the ticket is kept, by when the
+// read model says the ticket was confirmed. It's assumed to be kept while
+// the confirmation isn't projected yet.
+func (w *Worker) receiptKept(ctx context.Context, ticketID string) (bool, error) {
+	ticket, err := w.readModel.Get(ctx, ticketID)
+	if errors.Is(err, readmodel.ErrNotFound) {
+		return true, nil
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	err = w.spreadsheetsClient.AppendRow(
-		msg.Context(),
-		"tickets-to-print",
-		[]string{
-			event.TicketId,
-			event.CustomerEmail,
-			event.Price.Amount,
-			event.Price.Currency,
-		})
+	for _, event := range ticket.Events {
+		if event.Status == tickets.StatusConfirmed && event.Outcome == readmodel.OutcomeApplied {
+			return w.receipts.Kept(ctx, event.PublishedAt)
+		}
+	}
 
-	return err
+	return true, nil
 }
 
-func NewWorker(
-	receiptsClient clients.ReceiptsClient,
-	spreadsheetsClient clients.SpreadsheetsClient,
+// trackerSheets are the spreadsheets tickets are tracked in, by the status
+// they moved to.
+var trackerSheets = map[tickets.Status]string{
+	tickets.StatusConfirmed: "tickets-to-print",
+	tickets.StatusCanceled:  "tickets-to-refund",
+}
 
-	watermillLogger *log.WatermillLogrusAdapter,
-	router *message.Router,
-) *Worker {
-	rdb := redis.NewClient(&redis.Options{
-		Addr: os.Getenv("REDIS_ADDR"),
-	})
+// trackTransitions appends a row for every event the arrival of the event
+// applied to the ticket's lifecycle. The tracker projects events itself, so
+// it doesn't wait for the read model handler. Parked events get their row
+// once their predecessor arrives, rejected events are skipped.
+func (w *Worker) trackTransitions(ctx context.Context, ticket readmodel.Ticket, eventID string) error {
+	logger := log.FromContext(ctx).
+		WithField("ticket_id", ticket.TicketId).
+		WithField("event_id", eventID)
+
+	outcome, _ := ticket.Outcome(eventID)
+	switch outcome {
+	case readmodel.OutcomeParked:
+		logger.Info("Event parked until its predecessor arrives, its row is appended then")
+	case readmodel.OutcomeRejected:
+		logger.WithField("status", ticket.Status).Warn("Skipping event rejected by the ticket lifecycle")
+	}
 
-	issuerSub, err := redisstream.NewSubscriber(redisstream.SubscriberConfig{
-		Client:        rdb,
-		ConsumerGroup: "issue-receipt",
-	}, watermillLogger)
-	if err != nil {
-		panic("cant creat sub")
+	for _, event := range ticket.AppliedBy(eventID) {
+		err := w.spreadsheetsClient.AppendRow(
+			ctx,
+			trackerSheets[event.Status],
+			[]string{
+				ticket.TicketId,
+				event.CustomerEmail,
+				event.Price.Amount.String(),
+				event.Price.Currency.String(),
+			})
+		if err != nil {
+			return err
+		}
 	}
 
-	confirmedBookingSub, err := redisstream.NewSubscriber(redisstream.SubscriberConfig{
-		Client:        rdb,
-		ConsumerGroup: "append-to-tracker",
-	}, watermillLogger)
+	return nil
+}
+
+func (w *Worker) bookingCanceled(ctx context.Context, event *events.TicketBookingCanceled) error {
+	ticket, err := w.projection.ApplyBookingCanceled(ctx, event)
 	if err != nil {
-		panic("cant creat sub")
+		return err
 	}
 
-	canceledBookingSub, err := redisstream.NewSubscriber(redisstream.SubscriberConfig{
-		Client:        rdb,
-		ConsumerGroup: "append-to-tracker",
-	}, watermillLogger)
+	return w.trackTransitions(ctx, ticket, event.Header.Id)
+}
+
+func (w *Worker) bookingConfirmed(ctx context.Context, event *events.TicketBookingConfirmed) error {
+	ticket, err := w.projection.ApplyBookingConfirmed(ctx, event)
 	if err != nil {
-		panic("cant creat sub")
+		return err
 	}
 
+	return w.trackTransitions(ctx, ticket, event.Header.Id)
+}
+
+var consumerGroups = map[string]string{
+	"issue-receipt-handler": "issue-receipt",
+	"void-receipt-handler":  "void-receipt",
+	"ticket-read-model":     "ticket-read-model",
+	"append-to-tracker":     "append-to-tracker",
+}
+
+// consumerGroupStarts are the IDs consumer groups are created at, other
+// than the start of the stream. Voiding starts with the cancellations
+// published after it was deployed, as the receipts of earlier bookings were
+// not tracked and their cancellations would only be retried until they
+// land in the poison queue.
+var consumerGroupStarts = map[string]string{
+	"void-receipt": "$",
+}
+
+func NewWorker(
+	config Config,
+	receiptsClient clients.ReceiptsClient,
+	spreadsheetsClient RowAppender,
+
+	outboxStore *outbox.Store,
+	watermillLogger *log.WatermillLogrusAdapter,
+	router *message.Router,
+	metrics *metrics.Metrics,
+) (*Worker, error) {
+	rdb := redis.NewClient(config.Redis.options())
+	shared := sharedClient{rdb}
+
 	publisher, err := redisstream.NewPublisher(redisstream.PublisherConfig{
-		Client: rdb,
+		Client: shared,
 	}, watermillLogger)
 	if err != nil {
-		panic(err)
+		return nil, errors.Join(fmt.Errorf("cannot create publisher: %w", err), rdb.Close())
 	}
 
+	instrumentedPublisher := metrics.Publisher(publisher)
+
+	// The read model is shared by all instances, each of them projects
+	// only the events delivered to it.
+	readModel := readmodel.NewRedisRepository(shared, "read-model")
+
+	// Ticket events are numbered as they are forwarded, so the outbox
+	// stores them even while Redis is down.
+	sequencingPublisher := ordering.NewSequencingPublisher(
+		instrumentedPublisher,
+		ordering.NewSequencer(shared, "sequence:tickets", ordering.DefaultStateTTL),
+	)
+
 	worker := &Worker{
-		publisher: publisher,
-		router:    router,
+		rdb:        rdb,
+		publisher:  instrumentedPublisher,
+		bus:        eventbus.NewBus(outboxStore, config.Partitions),
+		partitions: config.Partitions,
+		forwarder:  outbox.NewForwarder(outboxStore, sequencingPublisher, outbox.ForwarderConfig{}, watermillLogger),
+		router:     router,
 
 		receiptsClient:     receiptsClient,
 		spreadsheetsClient: spreadsheetsClient,
+		receipts:           receipts.NewStore(shared, "receipts", config.ReceiptTTL),
+
+		readModel:  readModel,
+		projection: readmodel.NewProjection(readModel),
+		upcasters:  events.NewUpcasters(),
 	}
 
-	router.AddNoPublisherHandler("issue-receipt-handler", TicketBookingConfirmed, issuerSub, worker.issueReceiptHandler)
-	router.AddNoPublisherHandler("ticket-booking-confirmed", TicketBookingConfirmed, confirmedBookingSub, worker.bookingConfirmed)
-	router.AddNoPublisherHandler("ticket-booking-canceled", TicketBookingCanceled, canceledBookingSub, worker.bookingCanceled)
+	worker.processor = eventbus.NewProcessor(router, func(handlerName string) (message.Subscriber, error) {
+		consumer := config.Consumer
+		if consumer == "" {
+			consumer = watermill.NewShortUUID()
+		}
+
+		sub, err := redisstream.NewSubscriber(redisstream.SubscriberConfig{
+			Client:          shared,
+			Consumer:        consumer,
+			ConsumerGroup:   consumerGroups[handlerName],
+			OldestId:        consumerGroupStarts[consumerGroups[handlerName]],
+			BlockTime:       config.BlockTime,
+			ClaimInterval:   config.ClaimInterval,
+			MaxIdleTime:     config.MaxIdleTime,
+			ConsumerTimeout: config.ConsumerTimeout,
+			// Only entries left by the previous run or moved by the reclaimer.
+			ShouldClaimPendingMessage: claimsOwnEntriesSince(consumer, time.Now()),
+		}, watermillLogger)
+		if err != nil {
+			return nil, err
+		}
+
+		worker.subscribers = append(worker.subscribers, sub)
+
+		return sub, nil
+	}, worker.upcasters, config.Partitions)
+
+	err = eventbus.AddHandler(worker.processor, "issue-receipt-handler", worker.issueReceipt)
+	if err == nil {
+		err = eventbus.AddHandler(worker.processor, "void-receipt-handler", worker.voidReceipt)
+	}
+	if err == nil {
+		err = eventbus.AddHandlers(
+			worker.processor,
+			"ticket-read-model",
+			eventbus.On(worker.projection.OnBookingConfirmed),
+			eventbus.On(worker.projection.OnBookingCanceled),
+		)
+	}
+	if err == nil {
+		// Both events of a ticket are handled by one handler, so its rows
+		// are appended in the order the ticket was confirmed and canceled.
+		err = eventbus.AddHandlers(
+			worker.processor,
+			"append-to-tracker",
+			eventbus.On(worker.bookingConfirmed),
+			eventbus.On(worker.bookingCanceled),
+		)
+	}
+	if err == nil && !config.LegacyStreamsDrained {
+		err = worker.addLegacyHandlers()
+	}
+	if err != nil {
+		return nil, errors.Join(err, worker.closeResources())
+	}
 
-	return worker
-}
+	worker.reclaimer = reclaim.NewReclaimer(shared, worker.consumerGroups(), reclaim.Config{
+		Interval:        config.ReclaimInterval,
+		MinIdle:         config.MaxIdleTime,
+		ConsumerTimeout: config.ConsumerTimeout,
+		Observe:         metrics.ObserveReclaim,
+	}, watermillLogger)
 
-type Price struct {
-	Amount   string `json:"amount"`
-	Currency string `json:"currency"`
+	return worker, nil
 }
 
-type IssueReceiptPayload struct {
-	TicketId string `json:"ticket_id"`
-	Price    Price  `json:"price"`
-}
-type PrintTicketPayload struct {
-	TicketId      string `json:"ticket_id"`
-	CustomerEmail string `json:"customer_email"`
-	Price         Price  `json:"price"`
-}
+// addLegacyHandlers consumes the streams ticket events were published to
+// per event type, until they are drained. Events of a ticket left there are
+// handled apart from those published since, the read model and the tracker
+// park a cancellation until its confirmation arrives.
+func (w *Worker) addLegacyHandlers() error {
+	err := eventbus.AddLegacyHandlers(w.processor, "issue-receipt-handler", eventbus.On(w.issueReceipt))
+	if err == nil {
+		err = eventbus.AddLegacyHandlers(w.processor, "void-receipt-handler", eventbus.On(w.voidReceipt))
+	}
+	if err == nil {
+		err = eventbus.AddLegacyHandlers(
+			w.processor,
+			"ticket-read-model",
+			eventbus.On(w.projection.OnBookingConfirmed),
+			eventbus.On(w.projection.OnBookingCanceled),
+		)
+	}
+	if err == nil {
+		err = eventbus.AddLegacyHandlers(
+			w.processor,
+			"append-to-tracker",
+			eventbus.On(w.bookingConfirmed),
+			eventbus.On(w.bookingCanceled),
+		)
+	}
 
-type Header struct {
-	Id          string `json:"id"`
-	PublishedAt string `json:"published_at"`
+	return err
 }
 
-type Meta struct {
-	CorrelationId string `json:"correlation_id"`
+// claimsOwnEntriesSince returns which pending entries the subscriber of the
+// consumer, started at started, claims. Claiming entries of other consumers
+// would take over those their handlers still work on. The reclaimer moves
+// only entries of dead consumers, and the new owner redelivers them.
+//
+// Of its own entries, the subscriber claims only those delivered before it
+// started, left by the previous run of the consumer or moved by the
+// reclaimer. Entries delivered since may still be retried, or held while a
+// breaker is open, for longer than MaxIdleTime.
+func claimsOwnEntriesSince(consumer string, started time.Time) func(entry redis.XPendingExt) bool {
+	return func(entry redis.XPendingExt) bool {
+		return entry.Consumer == consumer && entry.Idle > time.Since(started)
+	}
 }
 
-func NewHeader() Header {
-	return Header{
-		Id:          uuid.NewString(),
-		PublishedAt: time.Now().Format(time.RFC3339),
+// consumerGroups returns the consumer groups of all partitions the handlers consume.
+func (w *Worker) consumerGroups() []reclaim.Group {
+	var groups []reclaim.Group
+	seen := map[reclaim.Group]bool{}
+	for _, handler := range w.processor.Handlers() {
+		group := reclaim.Group{Stream: handler.Topic, Name: consumerGroups[handler.Name]}
+		if !seen[group] {
+			seen[group] = true
+			groups = append(groups, group)
+		}
 	}
+
+	return groups
+}
+
+// Handlers returns the instances of the handlers of the worker, to configure
+// middlewares per handler with eventbus.PerHandler.
+func (w *Worker) Handlers() []eventbus.Handler {
+	return w.processor.Handlers()
 }
 
-var TicketBookingConfirmed = "TicketBookingConfirmed"
-var TicketBookingCanceled = "TicketBookingCanceled"
+// ReadModel returns the ticket read model the worker projects events to.
+func (w *Worker) ReadModel() readmodel.Repository {
+	return w.readModel
+}
 
-type TicketEvent struct {
-	Header        Header `json:"header"`
-	Meta          Meta   `json:"meta"`
-	TicketId      string `json:"ticket_id"`
-	CustomerEmail string `json:"customer_email"`
-	Price         Price  `json:"price"`
+// Redis returns the Redis client used by the worker. It is closed by Close.
+func (w *Worker) Redis() redis.UniversalClient {
+	return w.rdb
 }
 
-func (w *Worker) Send(msg Message) {
+// ErrInvalidTicket is returned by Send for tickets which can never be sent.
+var ErrInvalidTicket = errors.New("invalid ticket")
 
-	ticketEvent := TicketEvent{
-		Header:        NewHeader(),
-		Meta:          Meta{CorrelationId: msg.CorrelationId},
-		TicketId:      msg.Ticket.TicketId,
-		CustomerEmail: msg.Ticket.CustomerEmail,
-		Price: Price{
-			Amount:   msg.Ticket.Price.Amount,
-			Currency: msg.Ticket.Price.Currency,
-		},
-	}
+type SendResult struct {
+	TicketId string
+	Err      error
+}
 
-	payload, err := json.Marshal(ticketEvent)
-	if err != nil {
-		return
+func (w *Worker) Send(ctx context.Context, msgs ...Message) []SendResult {
+	results := make([]SendResult, 0, len(msgs))
+	for _, msg := range msgs {
+		err := w.send(ctx, msg)
+		if err != nil {
+			log.FromContext(ctx).
+				WithField("ticket_id", msg.Ticket.TicketId).
+				WithError(err).
+				Error("Cannot send ticket event")
+		}
+
+		results = append(results, SendResult{
+			TicketId: msg.Ticket.TicketId,
+			Err:      err,
+		})
 	}
 
-	borkerMsg := message.NewMessage(watermill.NewUUID(), payload)
-	middleware.SetCorrelationID(msg.CorrelationId, borkerMsg)
+	return results
+}
 
-	if msg.Ticket.Status == "confirmed" {
-		w.publisher.Publish(TicketBookingConfirmed, borkerMsg)
+func (w *Worker) send(ctx context.Context, msg Message) error {
+	if !msg.Ticket.Status.Valid() {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidTicket, msg.Ticket.Status)
 	}
 
-	if msg.Ticket.Status == "canceled" {
-		w.publisher.Publish(TicketBookingCanceled, borkerMsg)
+	meta := events.Meta{CorrelationId: log.CorrelationIDFromContext(ctx)}
+
+	// The sequence number is assigned when the event is forwarded.
+	var err error
+	switch msg.Ticket.Status {
+	case tickets.StatusConfirmed:
+		header := events.NewHeader[events.TicketBookingConfirmed]()
+		header.SequenceKey = msg.Ticket.TicketId
+
+		err = eventbus.Publish(ctx, w.bus, events.TicketBookingConfirmed{
+			Header:        header,
+			Meta:          meta,
+			TicketId:      msg.Ticket.TicketId,
+			CustomerEmail: msg.Ticket.CustomerEmail,
+			Price:         msg.Ticket.Price,
+		})
+	case tickets.StatusCanceled:
+		header := events.NewHeader[events.TicketBookingCanceled]()
+		header.SequenceKey = msg.Ticket.TicketId
+
+		err = eventbus.Publish(ctx, w.bus, events.TicketBookingCanceled{
+			Header:        header,
+			Meta:          meta,
+			TicketId:      msg.Ticket.TicketId,
+			CustomerEmail: msg.Ticket.CustomerEmail,
+			Price:         msg.Ticket.Price,
+		})
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidTicket, msg.Ticket.Status)
 	}
+	if err != nil {
+		return fmt.Errorf("cannot store ticket event in outbox: %w", err)
+	}
+
+	return nil
 }
 
-func (w *Worker) Run() {
-	ctx := context.Background()
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
-	defer cancel()
+// Run runs the router, the outbox forwarder and the reclaimer until the
+// worker is closed. They are not stopped by canceling ctx, so Close can
+// drain running handlers.
+func (w *Worker) Run(ctx context.Context) error {
+	ctx = context.WithoutCancel(ctx)
 
 	gr, ctx := errgroup.WithContext(ctx)
 
 	gr.Go(func() error {
-		return w.router.Run(context.Background())
+		return w.router.Run(ctx)
 	})
 
-	err := gr.Wait()
-	if err != nil {
-		panic(err)
+	gr.Go(func() error {
+		return w.forwarder.Run(ctx)
+	})
+
+	gr.Go(func() error {
+		return w.reclaimer.Run(ctx)
+	})
+
+	return gr.Wait()
+}
+
+// Running is closed when the router is running.
+func (w *Worker) Running() chan struct{} {
+	return w.router.Running()
+}
+
+// Close waits for running handlers to finish, then closes the forwarder,
+// the reclaimer, the publisher, the subscribers and the Redis pool, in that
+// order.
+func (w *Worker) Close(ctx context.Context) error {
+	routerClosed := make(chan error, 1)
+	go func() {
+		routerClosed <- w.router.Close()
+	}()
+
+	var errs []error
+	select {
+	case err := <-routerClosed:
+		errs = append(errs, err)
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("router not closed: %w", ctx.Err()))
+	}
+
+	errs = append(errs, w.closeResources())
+
+	return errors.Join(errs...)
+}
+
+func (w *Worker) closeResources() error {
+	var errs []error
+
+	errs = append(errs, w.forwarder.Close())
+	if w.reclaimer != nil {
+		errs = append(errs, w.reclaimer.Close())
+	}
+	errs = append(errs, w.publisher.Close())
+	for _, sub := range w.subscribers {
+		errs = append(errs, sub.Close())
 	}
-	<-ctx.Done()
+	errs = append(errs, w.rdb.Close())
+
+	return errors.Join(errs...)
 }
@@ -0,0 +1,151 @@
+package backgroundworkers
+
+import (
+	"context"
+	"testing"
+	"tickets/clients"
+	"tickets/metrics"
+	"tickets/outbox"
+	"tickets/tickets"
+	"time"
+
+	"github.com/ThreeDotsLabs/go-event-driven/common/log"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimsOwnEntriesSince(t *testing.T) {
+	shouldClaim := claimsOwnEntriesSince("worker-1", time.Now().Add(-time.Minute*10))
+
+	testCases := []struct {
+		name      string
+		entry     redis.XPendingExt
+		wantClaim bool
+	}{
+		{
+			name:      "left_by_previous_run",
+			entry:     redis.XPendingExt{Consumer: "worker-1", Idle: time.Minute * 15},
+			wantClaim: true,
+		},
+		{
+			name:      "moved_by_reclaimer",
+			entry:     redis.XPendingExt{Consumer: "worker-1", Idle: time.Since(time.Unix(0, 0))},
+			wantClaim: true,
+		},
+		{
+			// Its handler may still be retrying it.
+			name:      "delivered_since_started",
+			entry:     redis.XPendingExt{Consumer: "worker-1", Idle: time.Minute * 5},
+			wantClaim: false,
+		},
+		{
+			name:      "of_other_consumer",
+			entry:     redis.XPendingExt{Consumer: "worker-2", Idle: time.Minute * 15},
+			wantClaim: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantClaim, shouldClaim(tc.entry))
+		})
+	}
+}
+
+func newTestWorker(t *testing.T, redisAddr string) (*Worker, *outbox.Store) {
+	t.Helper()
+
+	logger := log.NewWatermill(logrus.NewEntry(logrus.StandardLogger()))
+
+	router, err := message.NewRouter(message.RouterConfig{}, logger)
+	require.NoError(t, err)
+
+	store, err := outbox.NewStore(t.TempDir(), logger)
+	require.NoError(t, err)
+
+	w, err := NewWorker(
+		Config{
+			Redis:           RedisConfig{Addr: redisAddr},
+			ReclaimInterval: time.Millisecond * 10,
+		},
+		clients.ReceiptsClient{},
+		&recordingAppender{rows: map[string][][]string{}},
+		store,
+		logger,
+		router,
+		metrics.New(prometheus.NewRegistry()),
+	)
+	require.NoError(t, err)
+
+	return w, store
+}
+
+func TestWorker_consumes_legacy_streams(t *testing.T) {
+	w, _ := newTestWorker(t, miniredis.RunT(t).Addr())
+	t.Cleanup(func() {
+		_ = w.closeResources()
+	})
+
+	routerNames := map[string]bool{}
+	for _, h := range w.Handlers() {
+		routerNames[h.RouterName] = true
+	}
+
+	for _, name := range []string{
+		"issue-receipt-handler@TicketBookingConfirmed",
+		"void-receipt-handler@TicketBookingCanceled",
+		"ticket-read-model@TicketBookingConfirmed",
+		"ticket-read-model@TicketBookingCanceled",
+		"append-to-tracker@TicketBookingConfirmed",
+		"append-to-tracker@TicketBookingCanceled",
+	} {
+		assert.True(t, routerNames[name], name)
+	}
+}
+
+func TestWorker_Run_returns_after_Close(t *testing.T) {
+	w, _ := newTestWorker(t, miniredis.RunT(t).Addr())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(context.Background())
+	}()
+	<-w.Running()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	require.NoError(t, w.Close(ctx))
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 3):
+		t.Fatal("Run didn't return after Close")
+	}
+}
+
+func TestWorker_Send_while_redis_is_down(t *testing.T) {
+	mr := miniredis.RunT(t)
+	w, store := newTestWorker(t, mr.Addr())
+	t.Cleanup(func() {
+		_ = w.closeResources()
+	})
+	mr.Close()
+
+	results := w.Send(context.Background(),
+		Message{Ticket: tickets.Ticket{TicketId: "ticket-1", Status: tickets.StatusConfirmed}},
+		Message{Ticket: tickets.Ticket{TicketId: "ticket-1", Status: tickets.StatusCanceled}},
+	)
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+	}
+
+	backlog, err := store.Backlog()
+	require.NoError(t, err)
+	assert.Equal(t, 2, backlog)
+}
@@ -0,0 +1,235 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"tickets/retry"
+	"time"
+)
+
+type State int32
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return fmt.Sprintf("unknown(%d)", int32(s))
+	}
+}
+
+type Config struct {
+	// FailureThreshold is the number of consecutive failures which opens the breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting trial calls through.
+	OpenTimeout time.Duration
+	// HalfOpenMaxCalls is the number of trial calls let through at once when half-open.
+	// The breaker closes once that many trial calls succeeded.
+	HalfOpenMaxCalls int
+
+	OnStateChange func(name string, state State)
+}
+
+func (c *Config) setDefaults() {
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = 5
+	}
+	if c.OpenTimeout == 0 {
+		c.OpenTimeout = time.Second * 30
+	}
+	if c.HalfOpenMaxCalls == 0 {
+		c.HalfOpenMaxCalls = 1
+	}
+}
+
+// ErrOpen is returned instead of calling the service while the breaker is open.
+type ErrOpen struct {
+	Breaker string
+}
+
+func (e ErrOpen) Error() string {
+	return fmt.Sprintf("circuit breaker %s is open", e.Breaker)
+}
+
+// Retryable reports false, as retrying right away is rejected as well.
+// Pause waits for the breaker instead.
+func (e ErrOpen) Retryable() bool {
+	return false
+}
+
+// Breaker stops calling a failing service for a while, so it's not flooded
+// with requests it cannot handle. Only retryable errors count as failures:
+// a rejected request means the service is up.
+type Breaker struct {
+	name   string
+	config Config
+	now    func() time.Time
+
+	mu            sync.Mutex
+	state         State
+	failures      int
+	successes     int
+	halfOpenCalls int
+	openedAt      time.Time
+}
+
+func New(name string, config Config) *Breaker {
+	config.setDefaults()
+
+	b := &Breaker{
+		name:   name,
+		config: config,
+		now:    time.Now,
+	}
+	if config.OnStateChange != nil {
+		config.OnStateChange(name, StateClosed)
+	}
+
+	return b
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+	return b.state
+}
+
+// Execute calls fn unless the breaker is open. A nil breaker always calls fn.
+func (b *Breaker) Execute(ctx context.Context, fn func(ctx context.Context) error) error {
+	if b == nil {
+		return fn(ctx)
+	}
+
+	if !b.allow() {
+		return ErrOpen{Breaker: b.name}
+	}
+
+	err := fn(ctx)
+	b.record(err)
+
+	return err
+}
+
+// Wait blocks until the breaker lets calls through or ctx is done.
+func (b *Breaker) Wait(ctx context.Context) error {
+	for {
+		delay, ok := b.waitTime()
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+
+	switch b.state {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		if b.halfOpenCalls >= b.config.HalfOpenMaxCalls {
+			return false
+		}
+		b.halfOpenCalls++
+	}
+
+	return true
+}
+
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := err != nil && !retry.IsPermanent(err) && !errors.Is(err, context.Canceled)
+
+	switch b.state {
+	case StateClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.config.FailureThreshold {
+			b.setState(StateOpen)
+		}
+	case StateHalfOpen:
+		if b.halfOpenCalls > 0 {
+			b.halfOpenCalls--
+		}
+		if failed {
+			b.setState(StateOpen)
+			return
+		}
+		b.successes++
+		if b.successes >= b.config.HalfOpenMaxCalls {
+			b.setState(StateClosed)
+		}
+	}
+}
+
+func (b *Breaker) waitTime() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+
+	switch b.state {
+	case StateOpen:
+		return b.openedAt.Add(b.config.OpenTimeout).Sub(b.now()), false
+	case StateHalfOpen:
+		if b.halfOpenCalls >= b.config.HalfOpenMaxCalls {
+			// Trial calls are in flight, check again once they may be done.
+			return b.config.OpenTimeout / 10, false
+		}
+	}
+
+	return 0, true
+}
+
+// refresh moves an open breaker to half-open once OpenTimeout passed.
+func (b *Breaker) refresh() {
+	if b.state == StateOpen && !b.now().Before(b.openedAt.Add(b.config.OpenTimeout)) {
+		b.setState(StateHalfOpen)
+	}
+}
+
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.failures = 0
+	b.successes = 0
+	b.halfOpenCalls = 0
+	if state == StateOpen {
+		b.openedAt = b.now()
+	}
+
+	if b.config.OnStateChange != nil {
+		b.config.OnStateChange(b.name, state)
+	}
+}
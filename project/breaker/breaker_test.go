@@ -0,0 +1,96 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"tickets/retry"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnavailable = errors.New("service unavailable")
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+
+	var states []State
+	b := New("receipts", Config{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Second,
+		OnStateChange: func(name string, state State) {
+			states = append(states, state)
+		},
+	})
+	b.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	fail := func(ctx context.Context) error { return errUnavailable }
+	succeed := func(ctx context.Context) error { return nil }
+
+	// Permanent errors mean the service is up.
+	require.Error(t, b.Execute(ctx, func(ctx context.Context) error { return retry.Permanent(errors.New("bad request")) }))
+	require.ErrorIs(t, b.Execute(ctx, fail), errUnavailable)
+	assert.Equal(t, StateClosed, b.State())
+
+	require.ErrorIs(t, b.Execute(ctx, fail), errUnavailable)
+	assert.Equal(t, StateOpen, b.State())
+
+	called := false
+	err := b.Execute(ctx, func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	assert.Equal(t, ErrOpen{Breaker: "receipts"}, err)
+	assert.False(t, called)
+
+	now = now.Add(time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	require.ErrorIs(t, b.Execute(ctx, fail), errUnavailable)
+	assert.Equal(t, StateOpen, b.State())
+
+	now = now.Add(time.Second)
+	require.NoError(t, b.Execute(ctx, succeed))
+	assert.Equal(t, StateClosed, b.State())
+
+	assert.Equal(t, []State{StateClosed, StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateClosed}, states)
+}
+
+func TestBreaker_half_open_limits_calls(t *testing.T) {
+	b := New("spreadsheets", Config{FailureThreshold: 1, OpenTimeout: time.Millisecond * 50})
+
+	ctx := context.Background()
+	require.Error(t, b.Execute(ctx, func(ctx context.Context) error { return errUnavailable }))
+
+	waitCtx, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+	defer cancel()
+	assert.ErrorIs(t, b.Wait(waitCtx), context.DeadlineExceeded)
+
+	require.NoError(t, b.Wait(ctx))
+
+	started := make(chan struct{})
+	trial := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- b.Execute(ctx, func(ctx context.Context) error {
+			close(started)
+			<-trial
+			return nil
+		})
+	}()
+	<-started
+
+	assert.ErrorAs(t, b.Execute(ctx, func(ctx context.Context) error { return nil }), &ErrOpen{})
+
+	close(trial)
+	require.NoError(t, <-done)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestNilBreaker(t *testing.T) {
+	var b *Breaker
+	assert.ErrorIs(t, b.Execute(context.Background(), func(ctx context.Context) error { return errUnavailable }), errUnavailable)
+}
@@ -0,0 +1,34 @@
+package breaker
+
+import (
+	"errors"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Pause holds messages of a handler while its breaker is open, so the
+// subscriber stops consuming instead of burning retries. A message failed
+// because the breaker opened during its retries is handled again once the
+// breaker lets calls through. Breakers are keyed by handler name.
+func Pause(breakers map[string]*Breaker) message.HandlerMiddleware {
+	return func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			b, ok := breakers[message.HandlerNameFromCtx(msg.Context())]
+			if !ok {
+				return h(msg)
+			}
+
+			for {
+				err := b.Wait(msg.Context())
+				if err != nil {
+					return nil, err
+				}
+
+				msgs, err := h(msg)
+				if !errors.As(err, &ErrOpen{}) {
+					return msgs, err
+				}
+			}
+		}
+	}
+}
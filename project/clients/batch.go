@@ -0,0 +1,155 @@
+package clients
+
+import (
+	"context"
+	"sync"
+	"tickets/retry"
+	"time"
+)
+
+type BatchConfig struct {
+	// MaxRows is the number of rows which triggers a flush.
+	MaxRows int
+	// MaxWait is how long the first row of a batch waits for more rows.
+	MaxWait time.Duration
+}
+
+func (c *BatchConfig) setDefaults() {
+	if c.MaxRows == 0 {
+		c.MaxRows = 10
+	}
+	if c.MaxWait == 0 {
+		c.MaxWait = time.Millisecond * 200
+	}
+}
+
+type batchedRow struct {
+	// ctx is the context of the message of the row, its deadline bounds the write.
+	ctx context.Context
+	row []string
+	// withdrawn rows were given up before the batch was flushed.
+	withdrawn bool
+}
+
+type rowBatch struct {
+	rows  []batchedRow
+	timer *time.Timer
+	done  chan struct{}
+	errs  []error
+}
+
+// RowBatcher collects rows appended concurrently and writes them per sheet
+// together. AppendRow returns only once its row was written, so messages
+// are acked after their own row succeeded, even if others of the batch failed.
+//
+// The spreadsheets API accepts a single row per request for now, so the
+// rows of a batch are still posted one by one.
+type RowBatcher struct {
+	client SpreadsheetsClient
+	config BatchConfig
+
+	mu      sync.Mutex
+	batches map[string]*rowBatch
+}
+
+func NewRowBatcher(client SpreadsheetsClient, config BatchConfig) *RowBatcher {
+	config.setDefaults()
+
+	return &RowBatcher{
+		client:  client,
+		config:  config,
+		batches: make(map[string]*rowBatch),
+	}
+}
+
+// AppendRow adds row to the current batch of the sheet and waits until the
+// batch was written. It returns the error of the row only, so rows written
+// before a failure of the batch are not appended again on redelivery.
+//
+// When ctx is done before the batch is flushed, the row is withdrawn from
+// it. Once the flush started, AppendRow waits for the row to be written, or
+// to fail on ctx, so it never reports a failure of a row written later.
+func (b *RowBatcher) AppendRow(ctx context.Context, spreadsheetName string, row []string) error {
+	batch, i := b.add(ctx, spreadsheetName, row)
+
+	select {
+	case <-batch.done:
+		return batch.errs[i]
+	case <-ctx.Done():
+		if b.withdraw(spreadsheetName, batch, i) {
+			return ctx.Err()
+		}
+	}
+
+	<-batch.done
+	return batch.errs[i]
+}
+
+// add returns the batch the row was added to and the index of the row in it.
+func (b *RowBatcher) add(ctx context.Context, spreadsheetName string, row []string) (*rowBatch, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	batch, ok := b.batches[spreadsheetName]
+	if !ok {
+		batch = &rowBatch{
+			done: make(chan struct{}),
+		}
+		batch.timer = time.AfterFunc(b.config.MaxWait, func() {
+			b.flush(spreadsheetName, batch)
+		})
+		b.batches[spreadsheetName] = batch
+	}
+
+	batch.rows = append(batch.rows, batchedRow{ctx: ctx, row: row})
+	i := len(batch.rows) - 1
+	if len(batch.rows) >= b.config.MaxRows && batch.timer.Stop() {
+		go b.flush(spreadsheetName, batch)
+	}
+
+	return batch, i
+}
+
+// withdraw removes the i-th row from the batch, unless its flush started.
+func (b *RowBatcher) withdraw(spreadsheetName string, batch *rowBatch, i int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.batches[spreadsheetName] != batch {
+		return false
+	}
+
+	batch.rows[i].withdrawn = true
+	return true
+}
+
+func (b *RowBatcher) flush(spreadsheetName string, batch *rowBatch) {
+	b.mu.Lock()
+	if b.batches[spreadsheetName] == batch {
+		delete(b.batches, spreadsheetName)
+	}
+	b.mu.Unlock()
+
+	batch.errs = make([]error, len(batch.rows))
+
+	// Rows rejected as invalid, or given up by their messages, fail alone.
+	// Other failures stop the appends, and the rows not written yet get
+	// the same error.
+	var failed error
+	for i, r := range batch.rows {
+		switch {
+		case r.withdrawn:
+			batch.errs[i] = r.ctx.Err()
+		case failed != nil:
+			batch.errs[i] = failed
+		default:
+			err := b.client.AppendRow(r.ctx, spreadsheetName, r.row)
+			if err != nil && !retry.IsPermanent(err) && r.ctx.Err() == nil {
+				failed = err
+			}
+			batch.errs[i] = err
+		}
+	}
+
+	close(batch.done)
+}
@@ -0,0 +1,214 @@
+package clients_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"tickets/clients"
+	"tickets/metrics"
+	"time"
+
+	commonClients "github.com/ThreeDotsLabs/go-event-driven/common/clients"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSpreadsheets struct {
+	mu     sync.Mutex
+	rows   map[string][][]string
+	status int
+	// availableRows, if not zero, is the number of rows written before status is returned.
+	availableRows int
+	// rejected are the first columns of the rows answered with 400.
+	rejected map[string]bool
+	// delay is how long a request takes, rows of canceled requests are not written.
+	delay time.Duration
+}
+
+func (f *fakeSpreadsheets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(r.URL.Path, "/")
+	sheet := parts[len(parts)-2]
+
+	body := struct {
+		Columns []string `json:"columns"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.rejected[body.Columns[0]] {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if f.status != 0 && (f.availableRows == 0 || len(f.rows[sheet]) >= f.availableRows) {
+		w.WriteHeader(f.status)
+		return
+	}
+	f.rows[sheet] = append(f.rows[sheet], body.Columns)
+	w.WriteHeader(http.StatusOK)
+}
+
+func newBatcher(t *testing.T, fake *fakeSpreadsheets, config clients.BatchConfig) *clients.RowBatcher {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	c, err := commonClients.NewClients(server.URL, nil)
+	require.NoError(t, err)
+
+	client := clients.NewSpreadsheetsClient(c, metrics.New(prometheus.NewRegistry()), nil, nil)
+	return clients.NewRowBatcher(client, config)
+}
+
+func appendConcurrently(b *clients.RowBatcher, sheet string, rows ...[]string) []error {
+	errs := make([]error, len(rows))
+
+	var wg sync.WaitGroup
+	for i, row := range rows {
+		wg.Add(1)
+		go func(i int, row []string) {
+			defer wg.Done()
+			errs[i] = b.AppendRow(context.Background(), sheet, row)
+		}(i, row)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+func TestRowBatcher_flushes_full_batch(t *testing.T) {
+	fake := &fakeSpreadsheets{rows: map[string][][]string{}}
+	b := newBatcher(t, fake, clients.BatchConfig{MaxRows: 3, MaxWait: time.Minute})
+
+	start := time.Now()
+	errs := appendConcurrently(b, "tickets-to-print", []string{"1"}, []string{"2"}, []string{"3"})
+
+	assert.Equal(t, []error{nil, nil, nil}, errs)
+	assert.Less(t, time.Since(start), time.Second*5)
+	assert.ElementsMatch(t, [][]string{{"1"}, {"2"}, {"3"}}, fake.rows["tickets-to-print"])
+}
+
+func TestRowBatcher_flushes_after_max_wait(t *testing.T) {
+	fake := &fakeSpreadsheets{rows: map[string][][]string{}}
+	b := newBatcher(t, fake, clients.BatchConfig{MaxRows: 10, MaxWait: time.Millisecond * 50})
+
+	start := time.Now()
+	require.NoError(t, b.AppendRow(context.Background(), "tickets-to-refund", []string{"1"}))
+
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*50)
+	assert.Equal(t, [][]string{{"1"}}, fake.rows["tickets-to-refund"])
+}
+
+func TestRowBatcher_fails_whole_batch(t *testing.T) {
+	fake := &fakeSpreadsheets{rows: map[string][][]string{}, status: http.StatusServiceUnavailable}
+	b := newBatcher(t, fake, clients.BatchConfig{MaxRows: 2, MaxWait: time.Minute})
+
+	errs := appendConcurrently(b, "tickets-to-print", []string{"1"}, []string{"2"})
+
+	for _, err := range errs {
+		assert.ErrorAs(t, err, &clients.ErrUnavailable{})
+	}
+}
+
+func TestRowBatcher_fails_only_unwritten_rows(t *testing.T) {
+	fake := &fakeSpreadsheets{
+		rows:          map[string][][]string{},
+		status:        http.StatusServiceUnavailable,
+		availableRows: 1,
+	}
+	b := newBatcher(t, fake, clients.BatchConfig{MaxRows: 3, MaxWait: time.Minute})
+
+	errs := appendConcurrently(b, "tickets-to-print", []string{"1"}, []string{"2"}, []string{"3"})
+
+	var written []string
+	failed := 0
+	for i, err := range errs {
+		if err == nil {
+			written = append(written, strconv.Itoa(i+1))
+			continue
+		}
+		assert.ErrorAs(t, err, &clients.ErrUnavailable{})
+		failed++
+	}
+
+	require.Len(t, fake.rows["tickets-to-print"], 1)
+	assert.Equal(t, [][]string{written}, fake.rows["tickets-to-print"])
+	assert.Equal(t, 2, failed)
+}
+
+func TestRowBatcher_skips_rejected_rows(t *testing.T) {
+	fake := &fakeSpreadsheets{
+		rows:     map[string][][]string{},
+		rejected: map[string]bool{"2": true},
+	}
+	b := newBatcher(t, fake, clients.BatchConfig{MaxRows: 3, MaxWait: time.Minute})
+
+	errs := appendConcurrently(b, "tickets-to-print", []string{"1"}, []string{"2"}, []string{"3"})
+
+	assert.NoError(t, errs[0])
+	assert.ErrorAs(t, errs[1], &clients.ErrBadRequest{})
+	assert.NoError(t, errs[2])
+	assert.ElementsMatch(t, [][]string{{"1"}, {"3"}}, fake.rows["tickets-to-print"])
+}
+
+func TestRowBatcher_withdraws_rows_given_up(t *testing.T) {
+	fake := &fakeSpreadsheets{rows: map[string][][]string{}}
+	b := newBatcher(t, fake, clients.BatchConfig{MaxRows: 10, MaxWait: time.Millisecond * 100})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	assert.ErrorIs(t, b.AppendRow(ctx, "tickets-to-print", []string{"1"}), context.DeadlineExceeded)
+	require.NoError(t, b.AppendRow(context.Background(), "tickets-to-print", []string{"2"}))
+
+	// The row given up is not written later, so its redelivery doesn't append it twice.
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Equal(t, [][]string{{"2"}}, fake.rows["tickets-to-print"])
+}
+
+func TestRowBatcher_writes_rows_with_their_context(t *testing.T) {
+	fake := &fakeSpreadsheets{rows: map[string][][]string{}, delay: time.Millisecond * 200}
+	b := newBatcher(t, fake, clients.BatchConfig{MaxRows: 2, MaxWait: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs[0] = b.AppendRow(ctx, "tickets-to-print", []string{"1"})
+	}()
+	go func() {
+		defer wg.Done()
+		errs[1] = b.AppendRow(context.Background(), "tickets-to-print", []string{"2"})
+	}()
+	wg.Wait()
+
+	// The deadline of the first row's message bounds its write, but doesn't fail the other row.
+	assert.ErrorIs(t, errs[0], context.DeadlineExceeded)
+	assert.NoError(t, errs[1])
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Equal(t, [][]string{{"2"}}, fake.rows["tickets-to-print"])
+}
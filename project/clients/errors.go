@@ -0,0 +1,134 @@
+package clients
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxBodyExcerpt = 256
+
+// ErrRateLimited is returned when the service throttles us; RetryAfter is
+// zero if the response didn't say how long to wait.
+type ErrRateLimited struct {
+	RetryAfter time.Duration
+	Body       string
+}
+
+func (e ErrRateLimited) Error() string {
+	return fmt.Sprintf("rate limited, retry after %v: %s", e.RetryAfter, e.Body)
+}
+
+func (e ErrRateLimited) Retryable() bool {
+	return true
+}
+
+func (e ErrRateLimited) RetryDelay() time.Duration {
+	return e.RetryAfter
+}
+
+type ErrConflict struct {
+	Body string
+}
+
+func (e ErrConflict) Error() string {
+	return fmt.Sprintf("conflict: %s", e.Body)
+}
+
+func (e ErrConflict) Retryable() bool {
+	return false
+}
+
+// ErrBadRequest means the request was rejected as invalid, Details holds the
+// validation errors returned by the service.
+type ErrBadRequest struct {
+	StatusCode int
+	Details    string
+}
+
+func (e ErrBadRequest) Error() string {
+	return fmt.Sprintf("bad request (%d): %s", e.StatusCode, e.Details)
+}
+
+func (e ErrBadRequest) Retryable() bool {
+	return false
+}
+
+type ErrUnavailable struct {
+	StatusCode int
+	Body       string
+}
+
+func (e ErrUnavailable) Error() string {
+	return fmt.Sprintf("service unavailable (%d): %s", e.StatusCode, e.Body)
+}
+
+func (e ErrUnavailable) Retryable() bool {
+	return true
+}
+
+// ErrUnexpectedStatus covers the remaining client errors, like missing
+// authorization, which won't succeed on retry either.
+type ErrUnexpectedStatus struct {
+	StatusCode int
+	Body       string
+}
+
+func (e ErrUnexpectedStatus) Error() string {
+	return fmt.Sprintf("unexpected status code %d: %s", e.StatusCode, e.Body)
+}
+
+func (e ErrUnexpectedStatus) Retryable() bool {
+	return false
+}
+
+func responseError(resp *http.Response, body []byte) error {
+	excerpt := bodyExcerpt(body)
+
+	switch code := resp.StatusCode; {
+	case code == http.StatusTooManyRequests:
+		return ErrRateLimited{
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+			Body:       excerpt,
+		}
+	case code == http.StatusConflict:
+		return ErrConflict{Body: excerpt}
+	case code == http.StatusBadRequest, code == http.StatusUnprocessableEntity:
+		return ErrBadRequest{StatusCode: code, Details: excerpt}
+	case code == http.StatusRequestTimeout, code >= 500:
+		return ErrUnavailable{StatusCode: code, Body: excerpt}
+	default:
+		return ErrUnexpectedStatus{StatusCode: code, Body: excerpt}
+	}
+}
+
+func bodyExcerpt(body []byte) string {
+	excerpt := strings.TrimSpace(string(body))
+	if len(excerpt) > maxBodyExcerpt {
+		excerpt = excerpt[:maxBodyExcerpt] + "..."
+	}
+
+	return excerpt
+}
+
+// retryAfter parses both forms of the Retry-After header: delay in seconds
+// and HTTP date.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
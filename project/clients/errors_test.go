@@ -0,0 +1,85 @@
+package clients
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"tickets/retry"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseError(t *testing.T) {
+	testCases := []struct {
+		name      string
+		status    int
+		header    http.Header
+		body      string
+		expected  error
+		retryable bool
+	}{
+		{
+			name:      "rate_limited",
+			status:    http.StatusTooManyRequests,
+			header:    http.Header{"Retry-After": []string{"3"}},
+			body:      "slow down",
+			expected:  ErrRateLimited{RetryAfter: time.Second * 3, Body: "slow down"},
+			retryable: true,
+		},
+		{
+			name:     "conflict",
+			status:   http.StatusConflict,
+			body:     "receipt already voided",
+			expected: ErrConflict{Body: "receipt already voided"},
+		},
+		{
+			name:     "bad_request",
+			status:   http.StatusBadRequest,
+			body:     `{"error": "invalid currency"}`,
+			expected: ErrBadRequest{StatusCode: http.StatusBadRequest, Details: `{"error": "invalid currency"}`},
+		},
+		{
+			name:      "unavailable",
+			status:    http.StatusBadGateway,
+			expected:  ErrUnavailable{StatusCode: http.StatusBadGateway},
+			retryable: true,
+		},
+		{
+			name:     "unauthorized",
+			status:   http.StatusUnauthorized,
+			expected: ErrUnexpectedStatus{StatusCode: http.StatusUnauthorized},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tc.status, Header: tc.header}
+			if resp.Header == nil {
+				resp.Header = http.Header{}
+			}
+
+			err := responseError(resp, []byte(tc.body))
+
+			assert.Equal(t, tc.expected, err)
+			assert.Equal(t, !tc.retryable, retry.IsPermanent(err))
+		})
+	}
+}
+
+func TestResponseError_truncates_body(t *testing.T) {
+	body := strings.Repeat("x", maxBodyExcerpt*2)
+
+	err := responseError(&http.Response{StatusCode: http.StatusInternalServerError}, []byte(body))
+
+	assert.Equal(t, strings.Repeat("x", maxBodyExcerpt)+"...", err.(ErrUnavailable).Body)
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Second*120, retryAfter("120"))
+	assert.Zero(t, retryAfter(""))
+	assert.Zero(t, retryAfter("soon"))
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	assert.InDelta(t, time.Minute, retryAfter(date), float64(time.Second*2))
+}
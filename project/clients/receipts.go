@@ -2,48 +2,123 @@ package clients
 
 import (
 	"context"
-	"fmt"
 	"net/http"
+	"tickets/breaker"
+	"tickets/metrics"
+	"tickets/money"
+	"tickets/tracing"
+	"time"
 
 	"github.com/ThreeDotsLabs/go-event-driven/common/clients"
 	"github.com/ThreeDotsLabs/go-event-driven/common/clients/receipts"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ReceiptsClient struct {
 	clients *clients.Clients
+	metrics *metrics.Metrics
+	breaker *breaker.Breaker
 }
 type IssueReceiptRequest struct {
-	TicketID string
-	Price    Price
+	TicketID       string
+	Price          money.Money
+	IdempotencyKey string
 }
 
-type Price struct {
-	Amount   string `json:"amount"`
-	Currency string `json:"currency"`
-}
-
-func NewReceiptsClient(clients *clients.Clients) ReceiptsClient {
+func NewReceiptsClient(clients *clients.Clients, metrics *metrics.Metrics, breaker *breaker.Breaker) ReceiptsClient {
 	return ReceiptsClient{
 		clients: clients,
+		metrics: metrics,
+		breaker: breaker,
 	}
 }
 
-func (c ReceiptsClient) IssueReceipt(ctx context.Context, request IssueReceiptRequest) error {
+type IssueReceiptResponse struct {
+	ReceiptNumber string
+	IssuedAt      time.Time
+}
+
+func (c ReceiptsClient) IssueReceipt(ctx context.Context, request IssueReceiptRequest) (IssueReceiptResponse, error) {
+	var resp IssueReceiptResponse
+	err := c.breaker.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = c.issueReceipt(ctx, request)
+		return err
+	})
+
+	return resp, err
+}
+
+func (c ReceiptsClient) issueReceipt(ctx context.Context, request IssueReceiptRequest) (_ IssueReceiptResponse, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "receipts.IssueReceipt", trace.WithSpanKind(trace.SpanKindClient))
+	defer func(start time.Time) {
+		tracing.RecordError(span, err)
+		span.End()
+		c.metrics.ObserveClientCall("receipts", "issue_receipt", start, err)
+	}(time.Now())
+
 	body := receipts.PutReceiptsJSONRequestBody{
-		TicketId: request.TicketID,
+		IdempotencyKey: &request.IdempotencyKey,
+		TicketId:       request.TicketID,
 		Price: receipts.Money{
-			MoneyAmount:   request.Price.Amount,
-			MoneyCurrency: request.Price.Currency,
+			MoneyAmount:   request.Price.Amount.String(),
+			MoneyCurrency: request.Price.Currency.String(),
 		},
 	}
 
 	receiptsResp, err := c.clients.Receipts.PutReceiptsWithResponse(ctx, body)
+	if err != nil {
+		return IssueReceiptResponse{}, err
+	}
+
+	// 201 for a new receipt, 200 when it was already issued with the same idempotency key.
+	receipt := receiptsResp.JSON201
+	if receiptsResp.StatusCode() == http.StatusOK {
+		receipt = receiptsResp.JSON200
+	}
+	if receipt == nil {
+		return IssueReceiptResponse{}, responseError(receiptsResp.HTTPResponse, receiptsResp.Body)
+	}
+
+	return IssueReceiptResponse{
+		ReceiptNumber: receipt.Number,
+		IssuedAt:      receipt.IssuedAt,
+	}, nil
+}
+
+type VoidReceiptRequest struct {
+	TicketID       string
+	Reason         string
+	IdempotencyKey string
+}
+
+func (c ReceiptsClient) VoidReceipt(ctx context.Context, request VoidReceiptRequest) error {
+	return c.breaker.Execute(ctx, func(ctx context.Context) error {
+		return c.voidReceipt(ctx, request)
+	})
+}
+
+func (c ReceiptsClient) voidReceipt(ctx context.Context, request VoidReceiptRequest) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "receipts.VoidReceipt", trace.WithSpanKind(trace.SpanKindClient))
+	defer func(start time.Time) {
+		tracing.RecordError(span, err)
+		span.End()
+		c.metrics.ObserveClientCall("receipts", "void_receipt", start, err)
+	}(time.Now())
+
+	body := receipts.PutVoidReceiptJSONRequestBody{
+		IdempotentId: &request.IdempotencyKey,
+		Reason:       request.Reason,
+		TicketId:     request.TicketID,
+	}
+
+	voidResp, err := c.clients.Receipts.PutVoidReceiptWithResponse(ctx, body)
 	if err != nil {
 		return err
 	}
 
-	if receiptsResp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %v", receiptsResp.StatusCode())
+	if voidResp.StatusCode() != http.StatusOK {
+		return responseError(voidResp.HTTPResponse, voidResp.Body)
 	}
 
 	return nil
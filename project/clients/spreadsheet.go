@@ -2,30 +2,66 @@ package clients
 
 import (
 	"context"
-	"fmt"
 	"net/http"
+	"tickets/breaker"
+	"tickets/metrics"
+	"tickets/money"
+	"tickets/ratelimit"
+	"tickets/tracing"
+	"time"
 
 	"github.com/ThreeDotsLabs/go-event-driven/common/clients"
 	"github.com/ThreeDotsLabs/go-event-driven/common/clients/spreadsheets"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type SpreadsheetsClient struct {
 	clients *clients.Clients
+	metrics *metrics.Metrics
+	breaker *breaker.Breaker
+	limiter *ratelimit.Limiter
 }
 
-func NewSpreadsheetsClient(clients *clients.Clients) SpreadsheetsClient {
+func NewSpreadsheetsClient(
+	clients *clients.Clients,
+	metrics *metrics.Metrics,
+	breaker *breaker.Breaker,
+	limiter *ratelimit.Limiter,
+) SpreadsheetsClient {
 	return SpreadsheetsClient{
 		clients: clients,
+		metrics: metrics,
+		breaker: breaker,
+		limiter: limiter,
 	}
 }
 
 type PrintTicketPayload struct {
 	TicketId      string
 	CustomerEmail string
-	Price         Price
+	Price         money.Money
 }
 
 func (c SpreadsheetsClient) AppendRow(ctx context.Context, spreadsheetName string, row []string) error {
+	// Sheets have separate quotas, so each one is limited on its own.
+	err := c.limiter.Wait(ctx, spreadsheetName)
+	if err != nil {
+		return err
+	}
+
+	return c.breaker.Execute(ctx, func(ctx context.Context) error {
+		return c.appendRow(ctx, spreadsheetName, row)
+	})
+}
+
+func (c SpreadsheetsClient) appendRow(ctx context.Context, spreadsheetName string, row []string) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "spreadsheets.AppendRow", trace.WithSpanKind(trace.SpanKindClient))
+	defer func(start time.Time) {
+		tracing.RecordError(span, err)
+		span.End()
+		c.metrics.ObserveClientCall("spreadsheets", "append_row", start, err)
+	}(time.Now())
+
 	request := spreadsheets.PostSheetsSheetRowsJSONRequestBody{
 		Columns: row,
 	}
@@ -35,7 +71,7 @@ func (c SpreadsheetsClient) AppendRow(ctx context.Context, spreadsheetName strin
 		return err
 	}
 	if sheetsResp.StatusCode() != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %v", sheetsResp.StatusCode())
+		return responseError(sheetsResp.HTTPResponse, sheetsResp.Body)
 	}
 
 	return nil
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	backgroundworkers "tickets/background-workers"
+	"tickets/breaker"
+	"tickets/clients"
+	"tickets/lifecycle"
+	"tickets/ratelimit"
+	"tickets/retry"
+	"time"
+)
+
+var defaultRetryPolicy = retry.Policy{
+	MaxAttempts:     11,
+	InitialInterval: time.Millisecond * 100,
+	MaxInterval:     time.Second,
+	Multiplier:      2,
+	Jitter:          0.1,
+}
+
+// handlerRetryPolicies are keyed by handler name.
+var handlerRetryPolicies = map[string]retry.Policy{
+	// Receipts are issued with an idempotency key, so they can be retried
+	// for longer while the service recovers.
+	"issue-receipt-handler": {
+		MaxAttempts:     20,
+		InitialInterval: time.Millisecond * 200,
+		MaxInterval:     time.Second * 10,
+		Multiplier:      2,
+		Jitter:          0.2,
+		MaxElapsedTime:  time.Minute * 2,
+	},
+	// Voiding waits for the receipt of the confirmation, which may be
+	// retried for a while itself.
+	"void-receipt-handler": {
+		MaxAttempts:     30,
+		InitialInterval: time.Millisecond * 200,
+		MaxInterval:     time.Second * 10,
+		Multiplier:      2,
+		Jitter:          0.2,
+		MaxElapsedTime:  time.Minute * 5,
+	},
+	// Appends are not idempotent, so a few quick attempts are enough
+	// before the message goes to the poison queue.
+	"append-to-tracker": {
+		MaxAttempts:     5,
+		InitialInterval: time.Millisecond * 500,
+		MaxInterval:     time.Second * 5,
+		Multiplier:      2,
+		Jitter:          0.2,
+		MaxElapsedTime:  time.Second * 30,
+	},
+}
+
+func loadWorkerConfig() (backgroundworkers.Config, error) {
+	config := backgroundworkers.Config{
+		Redis: backgroundworkers.RedisConfig{
+			Addr:     os.Getenv("REDIS_ADDR"),
+			Password: os.Getenv("REDIS_PASSWORD"),
+		},
+		Consumer: os.Getenv("REDIS_CONSUMER"),
+	}
+
+	var err error
+	if config.Redis.DB, err = envInt("REDIS_DB"); err != nil {
+		return config, err
+	}
+	if config.Redis.PoolSize, err = envInt("REDIS_POOL_SIZE"); err != nil {
+		return config, err
+	}
+	if config.BlockTime, err = envDuration("REDIS_BLOCK_TIME"); err != nil {
+		return config, err
+	}
+	if config.ClaimInterval, err = envDuration("REDIS_CLAIM_INTERVAL"); err != nil {
+		return config, err
+	}
+	if config.MaxIdleTime, err = envDuration("REDIS_MAX_IDLE_TIME"); err != nil {
+		return config, err
+	}
+	if config.ConsumerTimeout, err = envDuration("REDIS_CONSUMER_TIMEOUT"); err != nil {
+		return config, err
+	}
+	if config.ReclaimInterval, err = envDuration("REDIS_RECLAIM_INTERVAL"); err != nil {
+		return config, err
+	}
+	if config.Partitions, err = envInt("PARTITIONS"); err != nil {
+		return config, err
+	}
+	if config.LegacyStreamsDrained, err = envBool("LEGACY_STREAMS_DRAINED"); err != nil {
+		return config, err
+	}
+	if config.ReceiptTTL, err = envDuration("RECEIPT_TTL"); err != nil {
+		return config, err
+	}
+	if config.ReceiptTTL == 0 {
+		config.ReceiptTTL = time.Hour * 24 * 90
+	}
+
+	useTLS, err := envBool("REDIS_TLS")
+	if err != nil {
+		return config, err
+	}
+	if useTLS {
+		config.Redis.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	return config, nil
+}
+
+func loadBreakerConfig() (breaker.Config, error) {
+	config := breaker.Config{}
+
+	var err error
+	if config.FailureThreshold, err = envInt("BREAKER_FAILURE_THRESHOLD"); err != nil {
+		return config, err
+	}
+	if config.OpenTimeout, err = envDuration("BREAKER_OPEN_TIMEOUT"); err != nil {
+		return config, err
+	}
+	if config.HalfOpenMaxCalls, err = envInt("BREAKER_HALF_OPEN_MAX_CALLS"); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+var defaultSheetLimits = map[string]ratelimit.Limit{
+	"tickets-to-print":  {PerSecond: 5, Burst: 10},
+	"tickets-to-refund": {PerSecond: 5, Burst: 10},
+}
+
+// loadSheetLimits reads SHEETS_RATE_LIMITS, formatted as
+// "sheet=perSecond:burst,...", on top of the default limits.
+func loadSheetLimits() (map[string]ratelimit.Limit, error) {
+	limits := make(map[string]ratelimit.Limit, len(defaultSheetLimits))
+	for sheet, limit := range defaultSheetLimits {
+		limits[sheet] = limit
+	}
+
+	value := os.Getenv("SHEETS_RATE_LIMITS")
+	if value == "" {
+		return limits, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		sheet, limit, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid SHEETS_RATE_LIMITS entry %q", entry)
+		}
+		perSecond, burst, ok := strings.Cut(limit, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid SHEETS_RATE_LIMITS entry %q", entry)
+		}
+
+		l := ratelimit.Limit{}
+		var err error
+		if l.PerSecond, err = strconv.ParseFloat(perSecond, 64); err != nil {
+			return nil, fmt.Errorf("invalid SHEETS_RATE_LIMITS rate of %s: %w", sheet, err)
+		}
+		if l.Burst, err = strconv.Atoi(burst); err != nil {
+			return nil, fmt.Errorf("invalid SHEETS_RATE_LIMITS burst of %s: %w", sheet, err)
+		}
+		// A limit which lets nothing through would block the appends forever.
+		if !(l.PerSecond > 0) || math.IsInf(l.PerSecond, 1) {
+			return nil, fmt.Errorf("invalid SHEETS_RATE_LIMITS rate of %s: must be positive, got %s", sheet, perSecond)
+		}
+		if l.Burst < 1 {
+			return nil, fmt.Errorf("invalid SHEETS_RATE_LIMITS burst of %s: must be at least 1, got %d", sheet, l.Burst)
+		}
+
+		limits[sheet] = l
+	}
+
+	return limits, nil
+}
+
+func loadBatchConfig() (clients.BatchConfig, error) {
+	config := clients.BatchConfig{}
+
+	var err error
+	if config.MaxRows, err = envInt("SHEETS_BATCH_SIZE"); err != nil {
+		return config, err
+	}
+	if config.MaxWait, err = envDuration("SHEETS_BATCH_WAIT"); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+func loadLifecycleConfig() (lifecycle.Config, error) {
+	config := lifecycle.Config{}
+
+	var err error
+	if config.ShutdownTimeout, err = envDuration("SHUTDOWN_TIMEOUT"); err != nil {
+		return config, err
+	}
+	if config.ShutdownDelay, err = envDuration("SHUTDOWN_DELAY"); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+func envInt(key string) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return i, nil
+}
+
+func envDuration(key string) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return d, nil
+}
+
+func envBool(key string) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,85 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"tickets/events"
+	"tickets/ordering"
+	"tickets/tracing"
+
+	"github.com/ThreeDotsLabs/go-event-driven/common/log"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Bus struct {
+	publisher  message.Publisher
+	partitions int
+}
+
+// NewBus creates a bus publishing Partitioned events to the given number of
+// partitions. Other events, or all of them with a single partition, are
+// published to their topic.
+func NewBus(publisher message.Publisher, partitions int) *Bus {
+	return &Bus{
+		publisher:  publisher,
+		partitions: partitions,
+	}
+}
+
+// EventNameMetadata is the metadata key of the name of the event type, which
+// tells apart events of the types sharing a topic.
+const EventNameMetadata = "event_name"
+
+// TopicFor returns the topic events of type T are published to, which is the
+// PartitionStream of Partitioned events, and the name of the event type,
+// e.g. "TicketBookingConfirmed", of others.
+func TopicFor[T events.Event]() string {
+	var event T
+	if partitioned, ok := any(event).(Partitioned); ok {
+		return partitioned.PartitionStream()
+	}
+
+	return events.Name[T]()
+}
+
+func Publish[T events.Event](ctx context.Context, b *Bus, event T) (err error) {
+	topic := TopicFor[T]()
+	if partitioned, ok := any(event).(Partitioned); ok {
+		topic = PartitionTopic(topic, Partition(partitioned.PartitionKey(), b.partitions), b.partitions)
+	}
+
+	ctx, span := tracing.Tracer().Start(
+		ctx,
+		"publish "+topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", topic),
+			attribute.String("messaging.message.id", event.EventHeader().Id),
+		),
+	)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("cannot marshal %s: %w", topic, err)
+	}
+
+	// The event id is used as the message UUID, so redeliveries can be deduplicated.
+	msg := message.NewMessage(event.EventHeader().Id, payload)
+	msg.Metadata.Set(EventNameMetadata, events.Name[T]())
+	middleware.SetCorrelationID(log.CorrelationIDFromContext(ctx), msg)
+	if header := event.EventHeader(); header.SequenceKey != "" {
+		ordering.SetSequenceKey(msg, header.SequenceKey)
+	}
+	tracing.Inject(ctx, propagation.MapCarrier(msg.Metadata))
+
+	return b.publisher.Publish(topic, msg)
+}
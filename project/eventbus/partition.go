@@ -0,0 +1,88 @@
+package eventbus
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Partitioned events are published to one of the partitions of the stream
+// named by PartitionStream, chosen by the hash of PartitionKey. Event types
+// sharing the stream share its partitions, so all events with the same key
+// are consumed by the same handler instance, one at a time, in the order
+// they were published.
+type Partitioned interface {
+	PartitionKey() string
+	PartitionStream() string
+}
+
+// Partition returns the partition of key. The partition of a key is stable
+// only as long as the number of partitions doesn't change.
+func Partition(key string, partitions int) int {
+	if partitions <= 1 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(partitions))
+}
+
+// PartitionTopic returns the topic of the partition. With a single
+// partition it's the topic itself, so unpartitioned streams keep working.
+func PartitionTopic(topic string, partition int, partitions int) string {
+	if partitions <= 1 {
+		return topic
+	}
+
+	return fmt.Sprintf("%s.%d", topic, partition)
+}
+
+// PartitionTopics returns the topics of all partitions.
+func PartitionTopics(topic string, partitions int) []string {
+	if partitions <= 1 {
+		return []string{topic}
+	}
+
+	topics := make([]string, 0, partitions)
+	for p := 0; p < partitions; p++ {
+		topics = append(topics, PartitionTopic(topic, p, partitions))
+	}
+
+	return topics
+}
+
+// PartitionHandlerName returns the name of the router handler consuming the partition.
+func PartitionHandlerName(handlerName string, partition int, partitions int) string {
+	return PartitionTopic(handlerName, partition, partitions)
+}
+
+// LegacyTopics returns the topics partitioned events named eventName were
+// published to before they shared the stream named by PartitionStream: the
+// stream named after the event type, and its partitions.
+func LegacyTopics(eventName string, partitions int) []string {
+	topics := PartitionTopics(eventName, partitions)
+	if partitions > 1 {
+		topics = append([]string{eventName}, topics...)
+	}
+
+	return topics
+}
+
+// LegacyHandlerName returns the name of the router handler consuming the legacy topic.
+func LegacyHandlerName(handlerName string, topic string) string {
+	return handlerName + "@" + topic
+}
+
+// PerHandler copies settings keyed by handler name to the router names of
+// all instances of the handlers, for middlewares configured per handler.
+func PerHandler[V any](handlers []Handler, byHandler map[string]V) map[string]V {
+	perHandler := make(map[string]V, len(handlers))
+	for _, h := range handlers {
+		if v, ok := byHandler[h.Name]; ok {
+			perHandler[h.RouterName] = v
+		}
+	}
+
+	return perHandler
+}
@@ -0,0 +1,365 @@
+package eventbus_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"tickets/eventbus"
+	"tickets/events"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartition(t *testing.T) {
+	testCases := []struct {
+		name       string
+		partitions int
+		wantTopic  string
+	}{
+		{name: "not_partitioned", partitions: 0, wantTopic: "TicketBookingConfirmed"},
+		{name: "single_partition", partitions: 1, wantTopic: "TicketBookingConfirmed"},
+		{name: "partitioned", partitions: 4, wantTopic: "TicketBookingConfirmed.%d"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := eventbus.Partition("ticket-1", tc.partitions)
+			assert.Equal(t, p, eventbus.Partition("ticket-1", tc.partitions), "partition must be stable")
+			assert.GreaterOrEqual(t, p, 0)
+			assert.Less(t, p, max(tc.partitions, 1))
+
+			wantTopic := tc.wantTopic
+			if tc.partitions > 1 {
+				wantTopic = fmt.Sprintf(tc.wantTopic, p)
+			}
+			assert.Equal(t, wantTopic, eventbus.PartitionTopic("TicketBookingConfirmed", p, tc.partitions))
+			assert.Len(t, eventbus.PartitionTopics("TicketBookingConfirmed", tc.partitions), max(tc.partitions, 1))
+		})
+	}
+}
+
+func TestPartition_distribution(t *testing.T) {
+	const partitions = 4
+	const keys = 10000
+
+	counts := make([]int, partitions)
+	for i := 0; i < keys; i++ {
+		counts[eventbus.Partition(fmt.Sprintf("ticket-%d", i), partitions)]++
+	}
+
+	for p, count := range counts {
+		assert.InDelta(t, keys/partitions, count, keys/partitions*0.1, "partition %d", p)
+	}
+}
+
+// Partitions are picked by the hash modulo the number of partitions, so
+// changing it moves most keys to another partition. Events of a ticket
+// published before and after the change could then be handled at once by
+// two handler instances, out of order. Before changing PARTITIONS, stop
+// publishing and let the consumers drain every partition (the consumer lag
+// health check reports 0), then restart all workers with the new count.
+// Entries left in the old streams are not consumed anymore, except by the
+// read model rebuild.
+func TestPartition_rebalancing(t *testing.T) {
+	const keys = 1000
+
+	moved := 0
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("ticket-%d", i)
+		if eventbus.Partition(key, 4) != eventbus.Partition(key, 5) {
+			moved++
+		}
+	}
+
+	assert.Greater(t, moved, keys/2, "most keys are expected to move when partitions are added")
+}
+
+func TestPerHandler(t *testing.T) {
+	handlers := []eventbus.Handler{
+		{Name: "handler", RouterName: "handler.0"},
+		{Name: "handler", RouterName: "handler.1"},
+		{Name: "handler", RouterName: "handler@TicketBookingConfirmed"},
+		{Name: "other", RouterName: "other.0"},
+	}
+
+	assert.Equal(t, map[string]int{
+		"handler.0":                      1,
+		"handler.1":                      1,
+		"handler@TicketBookingConfirmed": 1,
+	}, eventbus.PerHandler(handlers, map[string]int{"handler": 1}))
+}
+
+func TestLegacyTopics(t *testing.T) {
+	assert.Equal(t, []string{"TicketBookingConfirmed"}, eventbus.LegacyTopics("TicketBookingConfirmed", 1))
+	assert.Equal(t, []string{
+		"TicketBookingConfirmed",
+		"TicketBookingConfirmed.0",
+		"TicketBookingConfirmed.1",
+	}, eventbus.LegacyTopics("TicketBookingConfirmed", 2))
+}
+
+// emptyPendingHook makes empty XPENDING replies of miniredis, which are nil,
+// empty lists like those of Redis, so subscribers can start.
+type emptyPendingHook struct{}
+
+func (emptyPendingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (emptyPendingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		if errors.Is(err, redis.Nil) && cmd.Name() == "xpending" {
+			cmd.SetErr(nil)
+			return nil
+		}
+		return err
+	}
+}
+
+func (emptyPendingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestProcessor_partitions(t *testing.T) {
+	const partitions = 3
+
+	logger := watermill.NopLogger{}
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	rdb.AddHook(emptyPendingHook{})
+
+	router, err := message.NewRouter(message.RouterConfig{}, logger)
+	require.NoError(t, err)
+
+	processor := eventbus.NewProcessor(router, func(handlerName string) (message.Subscriber, error) {
+		return redisstream.NewSubscriber(redisstream.SubscriberConfig{
+			Client:        rdb,
+			ConsumerGroup: handlerName,
+			BlockTime:     time.Millisecond * 10,
+		}, logger)
+	}, events.NewUpcasters(), partitions)
+
+	type handled struct {
+		handlerName string
+		eventName   string
+	}
+
+	var mu sync.Mutex
+	handledEvents := map[string][]handled{}
+	handle := func(ctx context.Context, ticketID string, eventName string) {
+		mu.Lock()
+		defer mu.Unlock()
+		handledEvents[ticketID] = append(handledEvents[ticketID], handled{
+			handlerName: message.HandlerNameFromCtx(ctx),
+			eventName:   eventName,
+		})
+	}
+
+	err = eventbus.AddHandlers(
+		processor,
+		"tracker",
+		eventbus.On(func(ctx context.Context, event *events.TicketBookingConfirmed) error {
+			// A cancellation handled meanwhile would be recorded first.
+			time.Sleep(time.Millisecond * 5)
+			handle(ctx, event.TicketId, event.EventName)
+			return nil
+		}),
+		eventbus.On(func(ctx context.Context, event *events.TicketBookingCanceled) error {
+			handle(ctx, event.TicketId, event.EventName)
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	// Cancellations are published to the same streams, and skipped.
+	err = eventbus.AddHandler(processor, "receipts", func(ctx context.Context, event *events.TicketBookingConfirmed) error {
+		handle(ctx, event.TicketId, event.EventName)
+		return nil
+	})
+	require.NoError(t, err)
+
+	handlers := processor.Handlers()
+	require.Len(t, handlers, 2*partitions)
+	for _, h := range handlers {
+		assert.Equal(t, eventbus.PartitionHandlerName(h.Name, h.Partition, partitions), h.RouterName)
+		assert.Equal(t, eventbus.PartitionTopic(events.TicketBookingsStream, h.Partition, partitions), h.Topic)
+	}
+
+	publisher, err := redisstream.NewPublisher(redisstream.PublisherConfig{Client: rdb}, logger)
+	require.NoError(t, err)
+
+	bus := eventbus.NewBus(publisher, partitions)
+	ctx := context.Background()
+
+	const tickets = 20
+	for i := 0; i < tickets; i++ {
+		ticketID := fmt.Sprintf("ticket-%d", i)
+
+		err := eventbus.Publish(ctx, bus, events.TicketBookingConfirmed{
+			Header:   events.NewHeader[events.TicketBookingConfirmed](),
+			TicketId: ticketID,
+		})
+		require.NoError(t, err)
+		err = eventbus.Publish(ctx, bus, events.TicketBookingCanceled{
+			Header:   events.NewHeader[events.TicketBookingCanceled](),
+			TicketId: ticketID,
+		})
+		require.NoError(t, err)
+	}
+
+	// All events wait in the streams, so only the handlers keep them in order.
+	go func() {
+		_ = router.Run(context.Background())
+	}()
+	t.Cleanup(func() {
+		_ = router.Close()
+	})
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		count := 0
+		for _, h := range handledEvents {
+			count += len(h)
+		}
+		return count == 3*tickets
+	}, time.Second*5, time.Millisecond*10)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for ticketID, h := range handledEvents {
+		p := eventbus.Partition(ticketID, partitions)
+
+		var tracked, receipts []handled
+		for _, e := range h {
+			if e.handlerName == eventbus.PartitionHandlerName("receipts", p, partitions) {
+				receipts = append(receipts, e)
+			} else {
+				tracked = append(tracked, e)
+			}
+		}
+
+		assert.Equal(t, []handled{
+			{handlerName: eventbus.PartitionHandlerName("tracker", p, partitions), eventName: "TicketBookingConfirmed"},
+			{handlerName: eventbus.PartitionHandlerName("tracker", p, partitions), eventName: "TicketBookingCanceled"},
+		}, tracked, ticketID)
+		assert.Equal(t, []handled{
+			{handlerName: eventbus.PartitionHandlerName("receipts", p, partitions), eventName: "TicketBookingConfirmed"},
+		}, receipts, ticketID)
+	}
+}
+
+type unpartitioned struct {
+	events.Header `json:"header"`
+}
+
+func (unpartitioned) SchemaVersion() int {
+	return 1
+}
+
+func TestAddHandlers_single_topic(t *testing.T) {
+	router, err := message.NewRouter(message.RouterConfig{}, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	processor := eventbus.NewProcessor(router, func(handlerName string) (message.Subscriber, error) {
+		return gochannel.NewGoChannel(gochannel.Config{}, watermill.NopLogger{}), nil
+	}, events.NewUpcasters(), 1)
+
+	err = eventbus.AddHandlers(processor, "empty")
+	assert.Error(t, err)
+
+	err = eventbus.AddHandlers(
+		processor,
+		"mixed",
+		eventbus.On(func(ctx context.Context, event *events.TicketBookingConfirmed) error { return nil }),
+		eventbus.On(func(ctx context.Context, event *unpartitioned) error { return nil }),
+	)
+	assert.Error(t, err)
+}
+
+func TestAddLegacyHandlers(t *testing.T) {
+	const partitions = 2
+
+	logger := watermill.NopLogger{}
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	rdb.AddHook(emptyPendingHook{})
+
+	router, err := message.NewRouter(message.RouterConfig{}, logger)
+	require.NoError(t, err)
+
+	processor := eventbus.NewProcessor(router, func(handlerName string) (message.Subscriber, error) {
+		return redisstream.NewSubscriber(redisstream.SubscriberConfig{
+			Client:        rdb,
+			ConsumerGroup: handlerName,
+			BlockTime:     time.Millisecond * 10,
+		}, logger)
+	}, events.NewUpcasters(), partitions)
+
+	var mu sync.Mutex
+	handled := map[string]string{}
+	handle := func(ctx context.Context, ticketID string) {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[ticketID] = message.HandlerNameFromCtx(ctx)
+	}
+
+	err = eventbus.AddLegacyHandlers(
+		processor,
+		"tracker",
+		eventbus.On(func(ctx context.Context, event *events.TicketBookingConfirmed) error {
+			handle(ctx, event.TicketId)
+			return nil
+		}),
+		eventbus.On(func(ctx context.Context, event *events.TicketBookingCanceled) error {
+			handle(ctx, event.TicketId)
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+	assert.Len(t, processor.Handlers(), 2*(partitions+1))
+
+	publisher, err := redisstream.NewPublisher(redisstream.PublisherConfig{Client: rdb}, logger)
+	require.NoError(t, err)
+
+	// Entries of the legacy streams don't name their event type.
+	legacy := map[string]string{
+		"ticket-1": "TicketBookingConfirmed",
+		"ticket-2": "TicketBookingConfirmed.1",
+		"ticket-3": "TicketBookingCanceled.0",
+	}
+	for ticketID, topic := range legacy {
+		payload := fmt.Sprintf(`{"header":{"id":%q},"ticket_id":%q}`, watermill.NewUUID(), ticketID)
+		require.NoError(t, publisher.Publish(topic, message.NewMessage(watermill.NewUUID(), []byte(payload))))
+	}
+
+	go func() {
+		_ = router.Run(context.Background())
+	}()
+	t.Cleanup(func() {
+		_ = router.Close()
+	})
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == len(legacy)
+	}, time.Second*5, time.Millisecond*10)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for ticketID, topic := range legacy {
+		assert.Equal(t, eventbus.LegacyHandlerName("tracker", topic), handled[ticketID])
+	}
+}
@@ -0,0 +1,196 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"tickets/events"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// SubscriberConstructor creates the subscriber used by the handler with the given name.
+type SubscriberConstructor func(handlerName string) (message.Subscriber, error)
+
+// Handler is a handler instance consuming one partition of its topic, or
+// one of the legacy topics of its events.
+type Handler struct {
+	// Name is the name the handler was added with.
+	Name string
+	// RouterName is the name of the router handler of the partition.
+	RouterName string
+	Topic      string
+	// Partition is the partition of Topic, 0 for legacy topics.
+	Partition int
+}
+
+type Processor struct {
+	router        *message.Router
+	newSubscriber SubscriberConstructor
+	upcasters     *events.Upcasters
+	partitions    int
+	handlers      []Handler
+}
+
+// NewProcessor creates a processor running one instance of every handler
+// per partition. It must use the number of partitions of the Bus.
+func NewProcessor(
+	router *message.Router,
+	newSubscriber SubscriberConstructor,
+	upcasters *events.Upcasters,
+	partitions int,
+) *Processor {
+	return &Processor{
+		router:        router,
+		newSubscriber: newSubscriber,
+		upcasters:     upcasters,
+		partitions:    partitions,
+	}
+}
+
+// EventHandler handles the events of one type, see AddHandlers.
+type EventHandler struct {
+	eventName string
+	topic     string
+	handle    func(ctx context.Context, upcasters *events.Upcasters, payload []byte) error
+}
+
+// On returns the handler of events of type T.
+func On[T events.Event](handle func(ctx context.Context, event *T) error) EventHandler {
+	return EventHandler{
+		eventName: events.Name[T](),
+		topic:     TopicFor[T](),
+		handle: func(ctx context.Context, upcasters *events.Upcasters, payload []byte) error {
+			event, err := Decode[T](upcasters, payload)
+			if err != nil {
+				return err
+			}
+
+			return handle(ctx, event)
+		},
+	}
+}
+
+func AddHandler[T events.Event](
+	p *Processor,
+	handlerName string,
+	handle func(ctx context.Context, event *T) error,
+) error {
+	return AddHandlers(p, handlerName, On(handle))
+}
+
+// AddHandlers adds a handler of events of several types published to the
+// same topic. Each partition is consumed by a single subscriber, so the
+// events of a partition key are handled one at a time, in the order they
+// were published, whatever their type. Events of other types are skipped.
+func AddHandlers(p *Processor, handlerName string, handlers ...EventHandler) error {
+	if len(handlers) == 0 {
+		return fmt.Errorf("handler %s handles no events", handlerName)
+	}
+
+	topic := handlers[0].topic
+	for _, h := range handlers[1:] {
+		if h.topic != topic {
+			return fmt.Errorf("handler %s handles events of topics %s and %s, it can consume only one", handlerName, topic, h.topic)
+		}
+	}
+
+	for partition, partitionTopic := range PartitionTopics(topic, p.partitions) {
+		routerName := PartitionHandlerName(handlerName, partition, p.partitions)
+
+		// Partitions of a topic are separate streams, so they share the consumer group.
+		sub, err := p.newSubscriber(handlerName)
+		if err != nil {
+			return fmt.Errorf("cannot create subscriber for %s: %w", routerName, err)
+		}
+
+		p.handlers = append(p.handlers, Handler{
+			Name:       handlerName,
+			RouterName: routerName,
+			Topic:      partitionTopic,
+			Partition:  partition,
+		})
+
+		p.router.AddNoPublisherHandler(routerName, partitionTopic, sub, func(msg *message.Message) error {
+			return Dispatch(msg.Context(), p.upcasters, handlers, msg)
+		})
+	}
+
+	return nil
+}
+
+// AddLegacyHandlers adds instances of the handler consuming the legacy
+// topics of the events, see LegacyTopics, so entries published there
+// before an upgrade are still handled. They share the consumer group of the
+// handler, which resumes where it stopped. Legacy topics are consumed apart
+// from the partitions, so their events aren't ordered with those published
+// since.
+func AddLegacyHandlers(p *Processor, handlerName string, handlers ...EventHandler) error {
+	for _, h := range handlers {
+		if h.topic == h.eventName {
+			// Published to the topic named after its type still.
+			continue
+		}
+
+		for _, topic := range LegacyTopics(h.eventName, p.partitions) {
+			routerName := LegacyHandlerName(handlerName, topic)
+
+			sub, err := p.newSubscriber(handlerName)
+			if err != nil {
+				return fmt.Errorf("cannot create subscriber for %s: %w", routerName, err)
+			}
+
+			p.handlers = append(p.handlers, Handler{
+				Name:       handlerName,
+				RouterName: routerName,
+				Topic:      topic,
+			})
+
+			handlers := []EventHandler{h}
+			p.router.AddNoPublisherHandler(routerName, topic, sub, func(msg *message.Message) error {
+				return Dispatch(msg.Context(), p.upcasters, handlers, msg)
+			})
+		}
+	}
+
+	return nil
+}
+
+// Dispatch handles msg with the handler of its event type, or skips it when
+// none of handlers handles it.
+func Dispatch(ctx context.Context, upcasters *events.Upcasters, handlers []EventHandler, msg *message.Message) error {
+	eventName := msg.Metadata.Get(EventNameMetadata)
+	if eventName == "" && len(handlers) == 1 {
+		// Published before the name was set, to the topic of a single event type.
+		eventName = handlers[0].eventName
+	}
+
+	for _, h := range handlers {
+		if h.eventName == eventName {
+			return h.handle(ctx, upcasters, msg.Payload)
+		}
+	}
+
+	return nil
+}
+
+// Decode upcasts payload to the current schema version and unmarshals it.
+func Decode[T events.Event](upcasters *events.Upcasters, payload []byte) (*T, error) {
+	payload, err := events.Upcast[T](upcasters, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	event := new(T)
+	err = json.Unmarshal(payload, event)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal %s: %w", events.Name[T](), err)
+	}
+
+	return event, nil
+}
+
+// Handlers returns the handlers added to the processor.
+func (p *Processor) Handlers() []Handler {
+	return p.handlers
+}
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"reflect"
+	"tickets/money"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Event interface {
+	EventHeader() Header
+	// SchemaVersion is the current version of the event payload. It must be
+	// bumped, with an upcaster registered for the previous version, whenever
+	// the payload changes in a way old consumers cannot read.
+	SchemaVersion() int
+}
+
+type Header struct {
+	Id            string `json:"id"`
+	PublishedAt   string `json:"published_at"`
+	EventName     string `json:"event_name"`
+	SchemaVersion int    `json:"schema_version"`
+	// SequenceKey orders the events of one entity, like a ticket. They are
+	// numbered when they are published to the broker, see
+	// ordering.SequencingPublisher. It's empty for events which are not ordered.
+	SequenceKey string `json:"sequence_key,omitempty"`
+}
+
+func NewHeader[T Event]() Header {
+	var event T
+
+	return Header{
+		Id:            uuid.NewString(),
+		PublishedAt:   time.Now().Format(time.RFC3339Nano),
+		EventName:     Name[T](),
+		SchemaVersion: event.SchemaVersion(),
+	}
+}
+
+// Name returns the name of the event type, e.g. "TicketBookingConfirmed".
+func Name[T Event]() string {
+	return reflect.TypeOf((*T)(nil)).Elem().Name()
+}
+
+func (h Header) EventHeader() Header {
+	return h
+}
+
+// TicketBookingsStream is the stream of the events of ticket bookings, so
+// the events of a ticket are consumed in the order they were published.
+// They were published to a stream per event type before, which the worker
+// keeps consuming until they are drained.
+const TicketBookingsStream = "TicketBookings"
+
+type Meta struct {
+	CorrelationId string `json:"correlation_id"`
+}
+
+type TicketBookingConfirmed struct {
+	Header        `json:"header"`
+	Meta          Meta        `json:"meta"`
+	TicketId      string      `json:"ticket_id"`
+	CustomerEmail string      `json:"customer_email"`
+	Price         money.Money `json:"price"`
+}
+
+func (TicketBookingConfirmed) SchemaVersion() int {
+	return 1
+}
+
+func (e TicketBookingConfirmed) PartitionKey() string {
+	return e.TicketId
+}
+
+func (TicketBookingConfirmed) PartitionStream() string {
+	return TicketBookingsStream
+}
+
+type TicketBookingCanceled struct {
+	Header        `json:"header"`
+	Meta          Meta        `json:"meta"`
+	TicketId      string      `json:"ticket_id"`
+	CustomerEmail string      `json:"customer_email"`
+	Price         money.Money `json:"price"`
+}
+
+func (TicketBookingCanceled) SchemaVersion() int {
+	return 1
+}
+
+func (e TicketBookingCanceled) PartitionKey() string {
+	return e.TicketId
+}
+
+func (TicketBookingCanceled) PartitionStream() string {
+	return TicketBookingsStream
+}
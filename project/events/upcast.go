@@ -0,0 +1,82 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Upcaster converts an event payload from one schema version to the next one.
+type Upcaster func(payload map[string]any) (map[string]any, error)
+
+// Upcasters lets handlers consume payloads published with older schema
+// versions, which may still be waiting in the streams after an event changes.
+type Upcasters struct {
+	upcasters map[string]map[int]Upcaster
+}
+
+func NewUpcasters() *Upcasters {
+	return &Upcasters{
+		upcasters: map[string]map[int]Upcaster{},
+	}
+}
+
+// Register adds an upcaster converting eventName payloads from fromVersion to fromVersion+1.
+func (u *Upcasters) Register(eventName string, fromVersion int, upcaster Upcaster) {
+	if _, ok := u.upcasters[eventName]; !ok {
+		u.upcasters[eventName] = map[int]Upcaster{}
+	}
+	u.upcasters[eventName][fromVersion] = upcaster
+}
+
+// Upcast converts payload of event T to the current schema version of T.
+// Payloads published before the header carried a version are treated as version 1.
+func Upcast[T Event](u *Upcasters, payload []byte) ([]byte, error) {
+	var event T
+	eventName := Name[T]()
+	currentVersion := event.SchemaVersion()
+
+	raw := map[string]any{}
+	err := json.Unmarshal(payload, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unmarshal %s: %w", eventName, err)
+	}
+
+	header, _ := raw["header"].(map[string]any)
+	if header == nil {
+		header = map[string]any{}
+	}
+
+	version := 1
+	if v, ok := header["schema_version"].(float64); ok && v > 0 {
+		version = int(v)
+	}
+
+	if version == currentVersion {
+		return payload, nil
+	}
+	if version > currentVersion {
+		return nil, fmt.Errorf("%s schema version %d is newer than supported %d", eventName, version, currentVersion)
+	}
+
+	for ; version < currentVersion; version++ {
+		upcaster, ok := u.upcasters[eventName][version]
+		if !ok {
+			return nil, fmt.Errorf("no upcaster for %s schema version %d", eventName, version)
+		}
+
+		raw, err = upcaster(raw)
+		if err != nil {
+			return nil, fmt.Errorf("cannot upcast %s from schema version %d: %w", eventName, version, err)
+		}
+	}
+
+	header, _ = raw["header"].(map[string]any)
+	if header == nil {
+		header = map[string]any{}
+	}
+	header["event_name"] = eventName
+	header["schema_version"] = currentVersion
+	raw["header"] = header
+
+	return json.Marshal(raw)
+}
@@ -0,0 +1,140 @@
+package events_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"tickets/events"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TicketPrinted is at schema version 3: version 2 renamed "email" to
+// "customer_email", version 3 split "price" into "amount" and "currency".
+type TicketPrinted struct {
+	events.Header `json:"header"`
+	TicketId      string `json:"ticket_id"`
+	CustomerEmail string `json:"customer_email"`
+	Amount        string `json:"amount"`
+	Currency      string `json:"currency"`
+}
+
+func (TicketPrinted) SchemaVersion() int {
+	return 3
+}
+
+func newUpcasters() *events.Upcasters {
+	upcasters := events.NewUpcasters()
+
+	upcasters.Register("TicketPrinted", 1, func(payload map[string]any) (map[string]any, error) {
+		payload["customer_email"] = payload["email"]
+		delete(payload, "email")
+		return payload, nil
+	})
+	upcasters.Register("TicketPrinted", 2, func(payload map[string]any) (map[string]any, error) {
+		price, _ := payload["price"].(string)
+		amount, currency, ok := strings.Cut(price, " ")
+		if !ok {
+			return nil, errors.New("price must be an amount and a currency")
+		}
+
+		payload["amount"], payload["currency"] = amount, currency
+		delete(payload, "price")
+		return payload, nil
+	})
+
+	return upcasters
+}
+
+func decode(t *testing.T, payload []byte) TicketPrinted {
+	event := TicketPrinted{}
+	require.NoError(t, json.Unmarshal(payload, &event))
+	return event
+}
+
+func TestUpcast(t *testing.T) {
+	testCases := []struct {
+		name    string
+		payload string
+	}{
+		{
+			name:    "v1_without_version",
+			payload: `{"header":{"id":"event-1"},"ticket_id":"ticket-1","email":"user@example.com","price":"49.90 EUR"}`,
+		},
+		{
+			name:    "v1",
+			payload: `{"header":{"id":"event-1","schema_version":1},"ticket_id":"ticket-1","email":"user@example.com","price":"49.90 EUR"}`,
+		},
+		{
+			name:    "v2",
+			payload: `{"header":{"id":"event-1","schema_version":2},"ticket_id":"ticket-1","customer_email":"user@example.com","price":"49.90 EUR"}`,
+		},
+		{
+			name:    "current_version",
+			payload: `{"header":{"id":"event-1","event_name":"TicketPrinted","schema_version":3},"ticket_id":"ticket-1","customer_email":"user@example.com","amount":"49.90","currency":"EUR"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := events.Upcast[TicketPrinted](newUpcasters(), []byte(tc.payload))
+			require.NoError(t, err)
+
+			assert.Equal(t, TicketPrinted{
+				Header: events.Header{
+					Id:            "event-1",
+					EventName:     "TicketPrinted",
+					SchemaVersion: 3,
+				},
+				TicketId:      "ticket-1",
+				CustomerEmail: "user@example.com",
+				Amount:        "49.90",
+				Currency:      "EUR",
+			}, decode(t, payload))
+		})
+	}
+}
+
+func TestUpcast_errors(t *testing.T) {
+	testCases := []struct {
+		name      string
+		upcasters *events.Upcasters
+		payload   string
+		wantErr   string
+	}{
+		{
+			name:      "newer_version",
+			upcasters: newUpcasters(),
+			payload:   `{"header":{"schema_version":4}}`,
+			wantErr:   "TicketPrinted schema version 4 is newer than supported 3",
+		},
+		{
+			name:      "missing_upcaster",
+			upcasters: events.NewUpcasters(),
+			payload:   `{"header":{"schema_version":2}}`,
+			wantErr:   "no upcaster for TicketPrinted schema version 2",
+		},
+		{
+			name:      "failing_upcaster",
+			upcasters: newUpcasters(),
+			payload:   `{"header":{"schema_version":2},"price":"49.90"}`,
+			wantErr:   "cannot upcast TicketPrinted from schema version 2: price must be an amount and a currency",
+		},
+		{
+			name:      "malformed_payload",
+			upcasters: newUpcasters(),
+			payload:   `{"header":`,
+			wantErr:   "cannot unmarshal TicketPrinted",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := events.Upcast[TicketPrinted](tc.upcasters, []byte(tc.payload))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErr)
+		})
+	}
+}
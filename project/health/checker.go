@@ -0,0 +1,138 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+type CheckFunc func(ctx context.Context) error
+
+// DetailFunc describes the state of a component which doesn't affect the status.
+type DetailFunc func() string
+
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentReport `json:"components"`
+	Details    map[string]string          `json:"details,omitempty"`
+}
+
+type ComponentReport struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+func (r Report) Up() bool {
+	return r.Status == StatusUp
+}
+
+type namedCheck struct {
+	name  string
+	check CheckFunc
+}
+
+type namedDetail struct {
+	name   string
+	detail DetailFunc
+}
+
+// Checker runs a set of component checks concurrently.
+type Checker struct {
+	timeout time.Duration
+	checks  []namedCheck
+	details []namedDetail
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+	}
+}
+
+func (c *Checker) Add(name string, check CheckFunc) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// AddDetail adds a detail to the reports, without checking the component.
+func (c *Checker) AddDetail(name string, detail DetailFunc) {
+	c.details = append(c.details, namedDetail{name: name, detail: detail})
+}
+
+func (c *Checker) Check(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{
+		Status:     StatusUp,
+		Components: make(map[string]ComponentReport, len(c.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range c.checks {
+		nc := nc
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			err := nc.check(ctx)
+
+			component := ComponentReport{
+				Status:   StatusUp,
+				Duration: time.Since(start).String(),
+			}
+			if err != nil {
+				component.Status = StatusDown
+				component.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[nc.name] = component
+			if err != nil {
+				report.Status = StatusDown
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(c.details) > 0 {
+		report.Details = make(map[string]string, len(c.details))
+		for _, nd := range c.details {
+			report.Details[nd.name] = nd.detail()
+		}
+	}
+
+	return report
+}
+
+// HTTPCheck reports url as down when it cannot be reached or answers with a server error.
+func HTTPCheck(client *http.Client, url string) CheckFunc {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("unexpected status code: %v", resp.StatusCode)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,163 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tickets/health"
+)
+
+func TestChecker_Check(t *testing.T) {
+	up := func(ctx context.Context) error {
+		return nil
+	}
+	down := func(ctx context.Context) error {
+		return errors.New("connection refused")
+	}
+
+	testCases := []struct {
+		name           string
+		checks         map[string]health.CheckFunc
+		expectedStatus string
+		expectedDown   map[string]string
+	}{
+		{
+			name:           "no checks",
+			checks:         map[string]health.CheckFunc{},
+			expectedStatus: health.StatusUp,
+			expectedDown:   map[string]string{},
+		},
+		{
+			name: "all up",
+			checks: map[string]health.CheckFunc{
+				"redis":   up,
+				"gateway": up,
+			},
+			expectedStatus: health.StatusUp,
+			expectedDown:   map[string]string{},
+		},
+		{
+			name: "one down",
+			checks: map[string]health.CheckFunc{
+				"redis":   up,
+				"gateway": down,
+			},
+			expectedStatus: health.StatusDown,
+			expectedDown: map[string]string{
+				"gateway": "connection refused",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			checker := health.NewChecker(time.Second)
+			for name, check := range tc.checks {
+				checker.Add(name, check)
+			}
+
+			report := checker.Check(context.Background())
+
+			assert.Equal(t, tc.expectedStatus, report.Status)
+			assert.Equal(t, tc.expectedStatus == health.StatusUp, report.Up())
+			require.Len(t, report.Components, len(tc.checks))
+
+			for name, component := range report.Components {
+				expectedErr, isDown := tc.expectedDown[name]
+				if isDown {
+					assert.Equal(t, health.StatusDown, component.Status, name)
+					assert.Equal(t, expectedErr, component.Error, name)
+				} else {
+					assert.Equal(t, health.StatusUp, component.Status, name)
+					assert.Empty(t, component.Error, name)
+				}
+				assert.NotEmpty(t, component.Duration, name)
+			}
+		})
+	}
+}
+
+func TestChecker_Check_details(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.Add("redis", func(ctx context.Context) error {
+		return nil
+	})
+	checker.AddDetail("receipts_breaker", func() string {
+		return "open"
+	})
+
+	report := checker.Check(context.Background())
+
+	assert.True(t, report.Up())
+	assert.Equal(t, map[string]string{"receipts_breaker": "open"}, report.Details)
+	assert.NotContains(t, report.Components, "receipts_breaker")
+}
+
+func TestChecker_Check_timeout(t *testing.T) {
+	checker := health.NewChecker(time.Millisecond * 50)
+	checker.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	report := checker.Check(context.Background())
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.False(t, report.Up())
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Components["slow"].Error)
+}
+
+func TestHTTPCheck(t *testing.T) {
+	testCases := []struct {
+		name        string
+		statusCode  int
+		expectedErr bool
+	}{
+		{
+			name:       "ok",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "client error",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:        "server error",
+			statusCode:  http.StatusServiceUnavailable,
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.statusCode)
+			}))
+			defer server.Close()
+
+			err := health.HTTPCheck(server.Client(), server.URL)(context.Background())
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHTTPCheck_unreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	err := health.HTTPCheck(http.DefaultClient, url)(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,116 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Request is the state of an idempotency key of a request.
+type Request struct {
+	// Reserved is true when the key was reserved by the call returning it.
+	Reserved bool
+	// Fingerprint identifies the request the key was first used with.
+	Fingerprint string
+	// Response is the saved response, nil while the request is in progress.
+	Response []byte
+}
+
+// Requests keeps idempotency keys of requests in Redis, together with the
+// fingerprint of the request and its response, so retries of a request get
+// the same response and reusing a key for a different request is detected.
+type Requests struct {
+	rdb            redis.UniversalClient
+	prefix         string
+	ttl            time.Duration
+	reservationTTL time.Duration
+}
+
+// NewRequests creates a store keeping responses for ttl. Keys of requests in
+// progress expire after reservationTTL, so a request which never completes,
+// e.g. because the instance handling it crashed, can be retried soon.
+func NewRequests(rdb redis.UniversalClient, prefix string, ttl time.Duration, reservationTTL time.Duration) *Requests {
+	return &Requests{
+		rdb:            rdb,
+		prefix:         prefix,
+		ttl:            ttl,
+		reservationTTL: reservationTTL,
+	}
+}
+
+func (r *Requests) key(key string) string {
+	return r.prefix + ":" + key
+}
+
+var reserveScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('HSET', KEYS[1], 'fingerprint', ARGV[1])
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return {1, ARGV[1]}
+end
+return {0, redis.call('HGET', KEYS[1], 'fingerprint'), redis.call('HGET', KEYS[1], 'response')}
+`)
+
+// Reserve marks key as in progress for the request with the fingerprint,
+// unless the key is already known. Then it returns the key's state.
+func (r *Requests) Reserve(ctx context.Context, key string, fingerprint string) (Request, error) {
+	result, err := reserveScript.Run(ctx, r.rdb, []string{r.key(key)}, fingerprint, r.reservationTTL.Milliseconds()).Slice()
+	if err != nil {
+		return Request{}, fmt.Errorf("cannot reserve idempotency key %s: %w", key, err)
+	}
+
+	request := Request{}
+	reserved, _ := result[0].(int64)
+	request.Reserved = reserved == 1
+	if len(result) > 1 {
+		request.Fingerprint, _ = result[1].(string)
+	}
+	if len(result) > 2 {
+		if response, ok := result[2].(string); ok {
+			request.Response = []byte(response)
+		}
+	}
+
+	return request, nil
+}
+
+var completeScript = redis.NewScript(`
+local fingerprint = redis.call('HGET', KEYS[1], 'fingerprint')
+if fingerprint and fingerprint ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'fingerprint', ARGV[1], 'response', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+
+// Complete saves the response of the request reserving key and keeps it for
+// the store's TTL. The key is left untouched if it expired meanwhile and
+// was reserved by a different request.
+func (r *Requests) Complete(ctx context.Context, key string, fingerprint string, response []byte) error {
+	err := completeScript.Run(ctx, r.rdb, []string{r.key(key)}, fingerprint, response, r.ttl.Milliseconds()).Err()
+	if err != nil {
+		return fmt.Errorf("cannot save response of idempotency key %s: %w", key, err)
+	}
+
+	return nil
+}
+
+var releaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'fingerprint') == ARGV[1] and redis.call('HEXISTS', KEYS[1], 'response') == 0 then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Release removes the reservation of key, so the request can be retried.
+func (r *Requests) Release(ctx context.Context, key string, fingerprint string) error {
+	err := releaseScript.Run(ctx, r.rdb, []string{r.key(key)}, fingerprint).Err()
+	if err != nil {
+		return fmt.Errorf("cannot release idempotency key %s: %w", key, err)
+	}
+
+	return nil
+}
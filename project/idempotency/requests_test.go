@@ -0,0 +1,97 @@
+package idempotency_test
+
+import (
+	"context"
+	"testing"
+	"tickets/idempotency"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequests(t *testing.T) (*idempotency.Requests, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	return idempotency.NewRequests(rdb, "idempotency:requests", time.Hour*24, time.Minute), mr
+}
+
+func TestRequests(t *testing.T) {
+	requests, mr := newRequests(t)
+	ctx := context.Background()
+
+	request, err := requests.Reserve(ctx, "key", "fingerprint")
+	require.NoError(t, err)
+	assert.Equal(t, idempotency.Request{Reserved: true, Fingerprint: "fingerprint"}, request)
+	assert.Equal(t, time.Minute, mr.TTL("idempotency:requests:key"))
+
+	// Retried while in progress.
+	request, err = requests.Reserve(ctx, "key", "fingerprint")
+	require.NoError(t, err)
+	assert.Equal(t, idempotency.Request{Fingerprint: "fingerprint"}, request)
+
+	err = requests.Complete(ctx, "key", "fingerprint", []byte("response"))
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour*24, mr.TTL("idempotency:requests:key"))
+
+	// Retried after it completed.
+	request, err = requests.Reserve(ctx, "key", "fingerprint")
+	require.NoError(t, err)
+	assert.Equal(t, idempotency.Request{Fingerprint: "fingerprint", Response: []byte("response")}, request)
+
+	// Reused for another request.
+	request, err = requests.Reserve(ctx, "key", "other-fingerprint")
+	require.NoError(t, err)
+	assert.False(t, request.Reserved)
+	assert.Equal(t, "fingerprint", request.Fingerprint)
+
+	// Releasing a completed request keeps its response.
+	require.NoError(t, requests.Release(ctx, "key", "fingerprint"))
+	request, err = requests.Reserve(ctx, "key", "fingerprint")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("response"), request.Response)
+}
+
+func TestRequests_release(t *testing.T) {
+	requests, _ := newRequests(t)
+	ctx := context.Background()
+
+	_, err := requests.Reserve(ctx, "key", "fingerprint")
+	require.NoError(t, err)
+
+	// Only the request holding the reservation releases it.
+	require.NoError(t, requests.Release(ctx, "key", "other-fingerprint"))
+	request, err := requests.Reserve(ctx, "key", "fingerprint")
+	require.NoError(t, err)
+	assert.False(t, request.Reserved)
+
+	require.NoError(t, requests.Release(ctx, "key", "fingerprint"))
+	request, err = requests.Reserve(ctx, "key", "fingerprint")
+	require.NoError(t, err)
+	assert.True(t, request.Reserved)
+}
+
+func TestRequests_reservation_expires(t *testing.T) {
+	requests, mr := newRequests(t)
+	ctx := context.Background()
+
+	_, err := requests.Reserve(ctx, "key", "fingerprint")
+	require.NoError(t, err)
+
+	// The instance handling the request crashed, it never completes.
+	mr.FastForward(time.Minute)
+
+	request, err := requests.Reserve(ctx, "key", "other-fingerprint")
+	require.NoError(t, err)
+	assert.True(t, request.Reserved)
+
+	// The crashed request doesn't overwrite the key reserved by another one.
+	err = requests.Complete(ctx, "key", "fingerprint", []byte("response"))
+	require.NoError(t, err)
+	request, err = requests.Reserve(ctx, "key", "other-fingerprint")
+	require.NoError(t, err)
+	assert.Equal(t, idempotency.Request{Fingerprint: "other-fingerprint"}, request)
+}
@@ -0,0 +1,54 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps idempotency keys in Redis, so they are shared by all instances.
+type Store struct {
+	rdb    redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func NewStore(rdb redis.UniversalClient, prefix string, ttl time.Duration) *Store {
+	return &Store{
+		rdb:    rdb,
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+func (s *Store) key(key string) string {
+	return s.prefix + ":" + key
+}
+
+// Get returns the value saved for key, or nil if key is unknown.
+func (s *Store) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.rdb.Get(ctx, s.key(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get idempotency key %s: %w", key, err)
+	}
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	return value, nil
+}
+
+func (s *Store) Save(ctx context.Context, key string, value []byte) error {
+	err := s.rdb.Set(ctx, s.key(key), value, s.ttl).Err()
+	if err != nil {
+		return fmt.Errorf("cannot save idempotency key %s: %w", key, err)
+	}
+
+	return nil
+}
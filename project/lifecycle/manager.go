@@ -0,0 +1,188 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+type State int32
+
+const (
+	StateStarting State = iota
+	StateRunning
+	StateShuttingDown
+	StateStopped
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateShuttingDown:
+		return "shutting_down"
+	case StateStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("unknown(%d)", int32(s))
+	}
+}
+
+type Config struct {
+	// ShutdownTimeout is how long components have to shut down, in total.
+	ShutdownTimeout time.Duration
+	// ShutdownDelay is how long to keep running after a signal was received,
+	// so health checks can report the shutdown before the HTTP server stops.
+	ShutdownDelay time.Duration
+}
+
+func (c *Config) setDefaults() {
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = time.Second * 30
+	}
+}
+
+// RunFunc runs a component. It must call started once the component is
+// ready to do its work, and block until the component is stopped by its
+// shutdown function or fails.
+type RunFunc func(ctx context.Context, started func()) error
+
+type component struct {
+	name     string
+	run      RunFunc
+	shutdown func(ctx context.Context) error
+}
+
+// Manager owns the root context of the service. It runs components until
+// SIGINT or SIGTERM is received or one of them fails, then shuts them down
+// in the order they were added.
+type Manager struct {
+	config     Config
+	components []component
+	state      atomic.Int32
+}
+
+func NewManager(config Config) *Manager {
+	config.setDefaults()
+
+	return &Manager{
+		config: config,
+	}
+}
+
+// Add registers a component. The service is running once all components
+// called started.
+func (m *Manager) Add(name string, run RunFunc, shutdown func(ctx context.Context) error) {
+	m.components = append(m.components, component{
+		name:     name,
+		run:      run,
+		shutdown: shutdown,
+	})
+}
+
+func (m *Manager) State() State {
+	return State(m.state.Load())
+}
+
+func (m *Manager) setState(state State) {
+	m.state.Store(int32(state))
+	logrus.WithField("state", state.String()).Info("Service state changed")
+}
+
+func (m *Manager) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var starting sync.WaitGroup
+	starting.Add(len(m.components))
+
+	gr, grCtx := errgroup.WithContext(ctx)
+	for _, c := range m.components {
+		c := c
+		started := sync.OnceFunc(func() {
+			logrus.WithField("component", c.name).Info("Component started")
+			starting.Done()
+		})
+
+		gr.Go(func() error {
+			err := c.run(grCtx, started)
+			if err != nil {
+				return fmt.Errorf("%s: %w", c.name, err)
+			}
+			return nil
+		})
+	}
+
+	allStarted := make(chan struct{})
+	go func() {
+		starting.Wait()
+		close(allStarted)
+	}()
+
+	select {
+	case <-allStarted:
+		m.setState(StateRunning)
+		<-grCtx.Done()
+	case <-grCtx.Done():
+	}
+	m.setState(StateShuttingDown)
+
+	if ctx.Err() != nil && m.config.ShutdownDelay > 0 {
+		logrus.WithField("delay", m.config.ShutdownDelay).Info("Delaying shutdown")
+		time.Sleep(m.config.ShutdownDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.config.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, c := range m.components {
+		logger := logrus.WithField("component", c.name)
+		logger.Info("Shutting down component")
+
+		start := time.Now()
+		err := c.shutdown(shutdownCtx)
+		if err != nil {
+			logger.WithError(err).Error("Component shutdown failed")
+			errs = append(errs, fmt.Errorf("%s shutdown: %w", c.name, err))
+			continue
+		}
+		logger.WithField("duration", time.Since(start)).Info("Component shut down")
+	}
+
+	errs = append(errs, gr.Wait())
+	m.setState(StateStopped)
+
+	return errors.Join(errs...)
+}
+
+// CheckRunning returns an error unless all components were started and no shutdown began.
+func (m *Manager) CheckRunning(ctx context.Context) error {
+	state := m.State()
+	if state != StateRunning {
+		return fmt.Errorf("service is %s", state)
+	}
+
+	return nil
+}
+
+// CheckAlive returns an error once the service stopped.
+func (m *Manager) CheckAlive(ctx context.Context) error {
+	state := m.State()
+	if state == StateStopped {
+		return fmt.Errorf("service is %s", state)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tickets/lifecycle"
+)
+
+// blockingComponent blocks until it's shut down, calling started when start is closed.
+type blockingComponent struct {
+	start   chan struct{}
+	stopped chan struct{}
+}
+
+func newBlockingComponent() *blockingComponent {
+	return &blockingComponent{
+		start:   make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (c *blockingComponent) run(ctx context.Context, started func()) error {
+	select {
+	case <-c.start:
+		started()
+	case <-c.stopped:
+		return nil
+	}
+
+	<-c.stopped
+	return nil
+}
+
+func (c *blockingComponent) shutdown(ctx context.Context) error {
+	close(c.stopped)
+	return nil
+}
+
+func runManager(t *testing.T, m *lifecycle.Manager) (context.CancelFunc, <-chan error) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Run(ctx)
+	}()
+
+	return cancel, done
+}
+
+func TestManager_running_after_all_components_started(t *testing.T) {
+	first := newBlockingComponent()
+	second := newBlockingComponent()
+
+	m := lifecycle.NewManager(lifecycle.Config{})
+	m.Add("first", first.run, first.shutdown)
+	m.Add("second", second.run, second.shutdown)
+
+	cancel, done := runManager(t, m)
+
+	close(first.start)
+	assert.Never(t, func() bool {
+		return m.State() != lifecycle.StateStarting
+	}, time.Millisecond*100, time.Millisecond*10)
+	assert.Error(t, m.CheckRunning(context.Background()))
+
+	close(second.start)
+	require.Eventually(t, func() bool {
+		return m.State() == lifecycle.StateRunning
+	}, time.Second, time.Millisecond*10)
+	assert.NoError(t, m.CheckRunning(context.Background()))
+
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("manager didn't stop")
+	}
+
+	assert.Equal(t, lifecycle.StateStopped, m.State())
+	assert.Error(t, m.CheckAlive(context.Background()))
+}
+
+func TestManager_stopped_before_all_components_started(t *testing.T) {
+	started := newBlockingComponent()
+	starting := newBlockingComponent()
+
+	m := lifecycle.NewManager(lifecycle.Config{})
+	m.Add("started", started.run, started.shutdown)
+	m.Add("starting", starting.run, starting.shutdown)
+
+	cancel, done := runManager(t, m)
+
+	close(started.start)
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("manager didn't stop")
+	}
+
+	assert.Equal(t, lifecycle.StateStopped, m.State())
+}
+
+func TestManager_component_fails_to_start(t *testing.T) {
+	healthy := newBlockingComponent()
+	errBroken := errors.New("broken")
+
+	m := lifecycle.NewManager(lifecycle.Config{})
+	m.Add("healthy", healthy.run, healthy.shutdown)
+	m.Add("broken", func(ctx context.Context, started func()) error {
+		return errBroken
+	}, func(ctx context.Context) error {
+		return nil
+	})
+
+	_, done := runManager(t, m)
+
+	close(healthy.start)
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, errBroken)
+	case <-time.After(time.Second):
+		t.Fatal("manager didn't stop")
+	}
+
+	assert.Equal(t, lifecycle.StateStopped, m.State())
+}
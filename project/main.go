@@ -2,13 +2,25 @@ package main
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
-	"os/signal"
 	backgroundworkers "tickets/background-workers"
+	"tickets/breaker"
 	externalClients "tickets/clients"
+	"tickets/eventbus"
+	"tickets/health"
+	"tickets/idempotency"
+	"tickets/lifecycle"
+	"tickets/metrics"
+	"tickets/ordering"
+	"tickets/outbox"
+	"tickets/poison"
 	"tickets/ports"
 	"tickets/ports/decorators"
+	"tickets/ratelimit"
+	"tickets/retry"
+	"tickets/tracing"
 	"time"
 
 	commonHTTP "github.com/ThreeDotsLabs/go-event-driven/common/http"
@@ -17,75 +29,273 @@ import (
 	"github.com/ThreeDotsLabs/go-event-driven/common/log"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/sync/errgroup"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 func main() {
 	log.Init(logrus.InfoLevel)
 
+	tracerProvider, err := tracing.NewTracerProvider(context.Background(), os.Getenv("OTEL_TRACES_EXPORTER"))
+	if err != nil {
+		panic(err)
+	}
+	tracing.Install(tracerProvider)
+
 	clients, err := clients.NewClients(os.Getenv("GATEWAY_ADDR"), func(ctx context.Context, req *http.Request) error {
 		req.Header.Set("Correlation-ID", log.CorrelationIDFromContext(ctx))
+		tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
 		return nil
 	})
 	if err != nil {
 		panic(err)
 	}
 
-	receiptsClient := externalClients.NewReceiptsClient(clients)
-	spreadsheetsClient := externalClients.NewSpreadsheetsClient(clients)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	m := metrics.New(registry)
+
+	breakerConfig, err := loadBreakerConfig()
+	if err != nil {
+		panic(err)
+	}
+	breakerConfig.OnStateChange = func(name string, state breaker.State) {
+		m.ObserveBreakerState(name, state)
+		logrus.WithFields(logrus.Fields{"breaker": name, "state": state}).Info("Circuit breaker state changed")
+	}
+	receiptsBreaker := breaker.New("receipts", breakerConfig)
+	spreadsheetsBreaker := breaker.New("spreadsheets", breakerConfig)
+
+	receiptsClient := externalClients.NewReceiptsClient(clients, m, receiptsBreaker)
+	sheetLimits, err := loadSheetLimits()
+	if err != nil {
+		panic(err)
+	}
+	sheetLimiter := ratelimit.New(sheetLimits, m.ObserveRateLimitWait)
+
+	spreadsheetsClient := externalClients.NewSpreadsheetsClient(clients, m, spreadsheetsBreaker, sheetLimiter)
+
+	batchConfig, err := loadBatchConfig()
+	if err != nil {
+		panic(err)
+	}
+	// The spreadsheets API takes a single row per request, so batching
+	// saves no calls and only delays the rows. It's off unless
+	// SHEETS_BATCH_SIZE is set. The tracker handles one event of each
+	// partition at a time, so a batch collects rows of different partitions.
+	var trackerSheets backgroundworkers.RowAppender = spreadsheetsClient
+	if batchConfig.MaxRows > 1 {
+		trackerSheets = externalClients.NewRowBatcher(spreadsheetsClient, batchConfig)
+	}
 
 	watermillLogger := log.NewWatermill(logrus.NewEntry(logrus.StandardLogger()))
 
-	router, err := message.NewRouter(message.RouterConfig{}, watermillLogger)
+	lifecycleConfig, err := loadLifecycleConfig()
+	if err != nil {
+		panic(err)
+	}
+	lc := lifecycle.NewManager(lifecycleConfig)
+
+	router, err := message.NewRouter(message.RouterConfig{
+		CloseTimeout: lifecycleConfig.ShutdownTimeout,
+	}, watermillLogger)
 	if err != nil {
 		panic(err)
 	}
 
 	router.AddMiddleware(middleware.CorrelationID)
+	router.AddMiddleware(tracing.Middleware)
 
 	router.AddMiddleware(decorators.CorrelationID)
 	router.AddMiddleware(decorators.UUID)
 
+	outboxDir := os.Getenv("OUTBOX_DIR")
+	if outboxDir == "" {
+		outboxDir = ".outbox"
+	}
+
+	outboxStore, err := outbox.NewStore(outboxDir, watermillLogger)
+	if err != nil {
+		panic(err)
+	}
+
+	metrics.RegisterGauge(registry, "outbox_backlog", "Number of events waiting in the outbox.", func() float64 {
+		backlog, err := outboxStore.Backlog()
+		if err != nil {
+			return -1
+		}
+		return float64(backlog)
+	})
+
+	workerConfig, err := loadWorkerConfig()
+	if err != nil {
+		panic(err)
+	}
+
+	w, err := backgroundworkers.NewWorker(workerConfig, receiptsClient, trackerSheets, outboxStore, watermillLogger, router, m)
+	if err != nil {
+		panic(err)
+	}
+	rdb := w.Redis()
+
+	poisonQueue, err := middleware.PoisonQueue(outboxStore, poison.Topic)
+	if err != nil {
+		panic(err)
+	}
+	router.AddMiddleware(poisonQueue)
+	router.AddMiddleware(m.HandlerMiddleware)
+
+	orderingTimeout, err := envDuration("ORDERING_TIMEOUT")
+	if err != nil {
+		panic(err)
+	}
+	// Deferred messages are published again through the outbox.
+	orderingBuffer := ordering.NewBuffer(rdb, "ordering", outboxStore, ordering.Config{
+		// The tracker follows the ticket lifecycle, so a cancellation waits for its confirmation.
+		Scopes: eventbus.PerHandler(w.Handlers(), map[string]string{
+			"append-to-tracker": "append-to-tracker",
+		}),
+		Timeout: orderingTimeout,
+		Observe: m.ObserveOrdering,
+	}, watermillLogger)
+	// Added before the idempotency middleware, which would mark deferred messages as handled.
+	router.AddMiddleware(orderingBuffer.Middleware)
+
+	router.AddMiddleware(decorators.Idempotency(idempotency.NewStore(rdb, "idempotency:events", time.Hour*24*7)))
+
+	router.AddMiddleware(breaker.Pause(eventbus.PerHandler(w.Handlers(), map[string]*breaker.Breaker{
+		"issue-receipt-handler": receiptsBreaker,
+		"void-receipt-handler":  receiptsBreaker,
+		"append-to-tracker":     spreadsheetsBreaker,
+	})))
+
 	router.AddMiddleware(
-		middleware.Retry{
-			MaxRetries:      10,
-			InitialInterval: time.Millisecond * 100,
-			MaxInterval:     time.Second,
-			Multiplier:      2,
-			Logger:          watermillLogger,
+		retry.Middleware{
+			Default:  defaultRetryPolicy,
+			Handlers: eventbus.PerHandler(w.Handlers(), handlerRetryPolicies),
+			Logger:   watermillLogger,
 		}.Middleware,
 	)
 
-	w := backgroundworkers.NewWorker(receiptsClient, spreadsheetsClient, watermillLogger, router)
-	httpPort := ports.NewHttpPort(w)
-	go w.Run()
+	router.AddMiddleware(decorators.CountAttempts)
+	router.AddMiddleware(m.RetryMiddleware)
+
+	httpPort := ports.NewHttpPort(w, idempotency.NewRequests(rdb, "idempotency:requests", time.Hour*24, time.Minute), lc, m)
+	poisonQueuePort := ports.NewPoisonQueuePort(poison.NewQueue(rdb, outboxStore))
+	ticketsPort := ports.NewTicketsPort(w.ReadModel(), w)
+
+	maxConsumerLag, err := envInt("HEALTH_MAX_CONSUMER_LAG")
+	if err != nil {
+		panic(err)
+	}
+	if maxConsumerLag == 0 {
+		maxConsumerLag = 1000
+	}
+
+	liveness := health.NewChecker(time.Second)
+	liveness.Add("lifecycle", lc.CheckAlive)
+
+	readiness := health.NewChecker(time.Second * 2)
+	readiness.Add("lifecycle", lc.CheckRunning)
+	readiness.Add("router", w.CheckRunning)
+	readiness.Add("redis", func(ctx context.Context) error {
+		return rdb.Ping(ctx).Err()
+	})
+	readiness.Add("consumer_lag", func(ctx context.Context) error {
+		return w.CheckConsumerLag(ctx, int64(maxConsumerLag))
+	})
+	readiness.Add("gateway", health.HTTPCheck(http.DefaultClient, os.Getenv("GATEWAY_ADDR")))
+	// An open breaker means a dependency is down, not this service, so it
+	// doesn't make the service unready.
+	readiness.AddDetail("receipts_breaker", func() string {
+		return receiptsBreaker.State().String()
+	})
+	readiness.AddDetail("spreadsheets_breaker", func() string {
+		return spreadsheetsBreaker.State().String()
+	})
+
+	healthPort := ports.NewHealthPort(liveness, readiness)
 
 	e := commonHTTP.NewEcho()
+	e.Pre(ports.CorrelationID)
+	e.Use(tracing.EchoMiddleware)
+	e.Use(m.EchoMiddleware)
+	e.GET("/metrics", metrics.Handler(registry))
 	e.GET("/health", httpPort.Health)
+	e.GET("/health/live", healthPort.Live)
+	e.GET("/health/ready", healthPort.Ready)
 	e.POST("/tickets-status", httpPort.TicketsStatus)
 
-	ctx := context.Background()
-	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
-	defer cancel()
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		logrus.Warn("ADMIN_TOKEN is not set, the admin endpoints reject all requests")
+	}
+	adminAuth := ports.AdminAuth(adminToken)
+
+	poisonQueueRoutes := e.Group("/poison-queue", adminAuth)
+	poisonQueueRoutes.GET("/messages", poisonQueuePort.List)
+	poisonQueueRoutes.DELETE("/messages", poisonQueuePort.Purge)
+	poisonQueueRoutes.GET("/messages/:id", poisonQueuePort.Get)
+	poisonQueueRoutes.DELETE("/messages/:id", poisonQueuePort.Remove)
+	poisonQueueRoutes.POST("/messages/:id/requeue", poisonQueuePort.Requeue)
 
-	gr, ctx := errgroup.WithContext(ctx)
+	// Tickets hold the emails of customers and the prices they paid.
+	ticketsRoutes := e.Group("/tickets", adminAuth)
+	ticketsRoutes.GET("", ticketsPort.List)
+	ticketsRoutes.GET("/:id", ticketsPort.Get)
+	ticketsRoutes.POST("/rebuild", ticketsPort.Rebuild)
+
+	lc.Add("http", func(ctx context.Context, started func()) error {
+		select {
+		case <-w.Running():
+		case <-ctx.Done():
+			return nil
+		}
 
-	gr.Go(func() error {
-		<-router.Running()
 		logrus.Info("Server starting...")
-		err := e.Start(":8080")
+		listener, err := net.Listen("tcp", ":8080")
+		if err != nil {
+			return err
+		}
+		// Echo serves on the listener set, which already accepts connections.
+		e.Listener = listener
+		started()
+
+		err = e.Start("")
 		if err != nil && err != http.ErrServerClosed {
 			return err
 		}
 
+		return nil
+	}, e.Shutdown)
+
+	lc.Add("worker", func(ctx context.Context, started func()) error {
+		go func() {
+			select {
+			case <-w.Running():
+				started()
+			case <-ctx.Done():
+			}
+		}()
+
+		return w.Run(ctx)
+	}, w.Close)
+	lc.Add("ordering", func(ctx context.Context, started func()) error {
+		started()
+		return orderingBuffer.Run(ctx)
+	}, func(ctx context.Context) error {
 		return nil
 	})
+	lc.Add("tracing", func(ctx context.Context, started func()) error {
+		started()
+		<-ctx.Done()
+		return nil
+	}, tracerProvider.Shutdown)
 
-	err = gr.Wait()
+	err = lc.Run(context.Background())
 	if err != nil {
-		panic(err)
+		logrus.WithError(err).Fatal("Service stopped with error")
 	}
-	<-ctx.Done()
-
 }
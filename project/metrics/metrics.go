@@ -0,0 +1,293 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"tickets/breaker"
+	"tickets/reclaim"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tickets"
+
+// Metrics holds all metrics of the service. It registers them in the
+// registerer passed to New, so tests can use their own registry.
+type Metrics struct {
+	handlerProcessed *prometheus.CounterVec
+	handlerFailed    *prometheus.CounterVec
+	handlerRetried   *prometheus.CounterVec
+	handlerDuration  *prometheus.HistogramVec
+
+	published *prometheus.CounterVec
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	clientDuration *prometheus.HistogramVec
+	breakerState   *prometheus.GaugeVec
+	rateLimitWait  *prometheus.HistogramVec
+
+	orderedMessages *prometheus.CounterVec
+	reorderWait     *prometheus.HistogramVec
+
+	stuckMessages     *prometheus.GaugeVec
+	reclaimedMessages *prometheus.CounterVec
+	orphanedMessages  *prometheus.GaugeVec
+
+	RejectedTickets prometheus.Counter
+}
+
+func New(registerer prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		handlerProcessed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "handler_messages_processed_total",
+			Help:      "Number of messages processed successfully by a handler.",
+		}, []string{"handler"}),
+		handlerFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "handler_messages_failed_total",
+			Help:      "Number of messages a handler failed to process after all retries.",
+		}, []string{"handler"}),
+		handlerRetried: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "handler_retries_total",
+			Help:      "Number of times a handler retried a message.",
+		}, []string{"handler"}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "handler_duration_seconds",
+			Help:      "Time a handler spent on a message, including retries.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"handler", "result"}),
+		published: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_published_total",
+			Help:      "Number of messages published to the broker.",
+		}, []string{"topic", "result"}),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests handled.",
+		}, []string{"method", "path", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time spent handling HTTP requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "path"}),
+		clientDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "client_request_duration_seconds",
+			Help:      "Time spent calling external services.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"client", "operation", "result"}),
+		breakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "circuit_breaker_state",
+			Help:      "State of a circuit breaker: 0 closed, 1 open, 2 half-open.",
+		}, []string{"breaker"}),
+		rateLimitWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_wait_seconds",
+			Help:      "Time spent waiting for a rate limiter before calling an external service.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"limiter"}),
+		orderedMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ordered_messages_total",
+			Help:      "Number of sequenced messages by whether they arrived in order, were reordered, timed out waiting or were late.",
+		}, []string{"handler", "outcome"}),
+		reorderWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "reorder_wait_seconds",
+			Help:      "Time messages which arrived ahead of their predecessor waited for it.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"handler"}),
+		stuckMessages: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "stuck_messages",
+			Help:      "Number of messages pending in a consumer group for longer than the max idle time.",
+		}, []string{"stream", "group"}),
+		reclaimedMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reclaimed_messages_total",
+			Help:      "Number of stuck messages moved from dead consumers to live ones.",
+		}, []string{"stream", "group"}),
+		orphanedMessages: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "orphaned_messages",
+			Help:      "Number of stuck messages held by dead consumers of a group without live consumers.",
+		}, []string{"stream", "group"}),
+		RejectedTickets: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "status_rejected_tickets_total",
+			Help:      "Number of tickets rejected by the tickets status webhook validation.",
+		}),
+	}
+
+	registerer.MustRegister(
+		m.handlerProcessed,
+		m.handlerFailed,
+		m.handlerRetried,
+		m.handlerDuration,
+		m.published,
+		m.httpRequests,
+		m.httpDuration,
+		m.clientDuration,
+		m.breakerState,
+		m.rateLimitWait,
+		m.orderedMessages,
+		m.reorderWait,
+		m.stuckMessages,
+		m.reclaimedMessages,
+		m.orphanedMessages,
+		m.RejectedTickets,
+	)
+
+	return m
+}
+
+// RegisterGauge registers a gauge reporting the value returned by value.
+func RegisterGauge(registerer prometheus.Registerer, name string, help string, value func() float64) {
+	registerer.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
+
+func Handler(gatherer prometheus.Gatherer) echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+}
+
+// HandlerMiddleware measures the outcome of handling a message.
+// It must be added before the Retry middleware.
+func (m *Metrics) HandlerMiddleware(next message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		handler := message.HandlerNameFromCtx(msg.Context())
+		start := time.Now()
+
+		msgs, err := next(msg)
+
+		result := "success"
+		if err != nil {
+			result = "error"
+			m.handlerFailed.WithLabelValues(handler).Inc()
+		} else {
+			m.handlerProcessed.WithLabelValues(handler).Inc()
+		}
+		m.handlerDuration.WithLabelValues(handler, result).Observe(time.Since(start).Seconds())
+
+		return msgs, err
+	}
+}
+
+type attemptsKey struct{}
+
+// RetryMiddleware counts retries. It must be added after the Retry middleware.
+func (m *Metrics) RetryMiddleware(next message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		// Retry calls the handler again with the same message, so the counter
+		// stored in its context on the first attempt is seen by the next ones.
+		attempts, ok := msg.Context().Value(attemptsKey{}).(*int)
+		if !ok {
+			attempts = new(int)
+			msg.SetContext(context.WithValue(msg.Context(), attemptsKey{}, attempts))
+		}
+
+		*attempts++
+		if *attempts > 1 {
+			m.handlerRetried.WithLabelValues(message.HandlerNameFromCtx(msg.Context())).Inc()
+		}
+
+		return next(msg)
+	}
+}
+
+// EchoMiddleware measures HTTP requests.
+func (m *Metrics) EchoMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+
+		err := next(c)
+
+		status := c.Response().Status
+		if err != nil {
+			if httpErr, ok := err.(*echo.HTTPError); ok {
+				status = httpErr.Code
+			} else {
+				status = http.StatusInternalServerError
+			}
+		}
+
+		path := c.Path()
+		m.httpRequests.WithLabelValues(c.Request().Method, path, strconv.Itoa(status)).Inc()
+		m.httpDuration.WithLabelValues(c.Request().Method, path).Observe(time.Since(start).Seconds())
+
+		return err
+	}
+}
+
+// ObserveClientCall records a call to an external service which started at start.
+func (m *Metrics) ObserveClientCall(client string, operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+
+	m.clientDuration.WithLabelValues(client, operation, result).Observe(time.Since(start).Seconds())
+}
+
+// ObserveBreakerState records the state a circuit breaker moved to.
+func (m *Metrics) ObserveBreakerState(name string, state breaker.State) {
+	m.breakerState.WithLabelValues(name).Set(float64(state))
+}
+
+// ObserveRateLimitWait records the time a call waited for the rate limiter.
+func (m *Metrics) ObserveRateLimitWait(limiter string, wait time.Duration) {
+	m.rateLimitWait.WithLabelValues(limiter).Observe(wait.Seconds())
+}
+
+// ObserveOrdering records how a sequenced message was ordered before handler handled it.
+func (m *Metrics) ObserveOrdering(handler string, outcome string, wait time.Duration) {
+	m.orderedMessages.WithLabelValues(handler, outcome).Inc()
+	if wait > 0 {
+		m.reorderWait.WithLabelValues(handler).Observe(wait.Seconds())
+	}
+}
+
+// ObserveReclaim records the result of an inspection of the pending messages of a consumer group.
+func (m *Metrics) ObserveReclaim(group reclaim.Group, result reclaim.Result) {
+	m.stuckMessages.WithLabelValues(group.Stream, group.Name).Set(float64(result.Stuck))
+	m.reclaimedMessages.WithLabelValues(group.Stream, group.Name).Add(float64(result.Reclaimed))
+	m.orphanedMessages.WithLabelValues(group.Stream, group.Name).Set(float64(result.Orphaned))
+}
+
+// Publisher counts messages published with pub per topic.
+func (m *Metrics) Publisher(pub message.Publisher) message.Publisher {
+	return publisher{Publisher: pub, metrics: m}
+}
+
+type publisher struct {
+	message.Publisher
+	metrics *Metrics
+}
+
+func (p publisher) Publish(topic string, msgs ...*message.Message) error {
+	err := p.Publisher.Publish(topic, msgs...)
+
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	p.metrics.published.WithLabelValues(topic, result).Add(float64(len(msgs)))
+
+	return err
+}
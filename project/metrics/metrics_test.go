@@ -0,0 +1,115 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"tickets/metrics"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := metrics.New(registry)
+
+	logger := watermill.NopLogger{}
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, logger)
+
+	router, err := message.NewRouter(message.RouterConfig{}, logger)
+	require.NoError(t, err)
+
+	router.AddMiddleware(m.HandlerMiddleware)
+	router.AddMiddleware(middleware.Retry{MaxRetries: 2}.Middleware)
+	router.AddMiddleware(m.RetryMiddleware)
+
+	attempts := 0
+	router.AddNoPublisherHandler("flaky-handler", "flaky", pubSub, func(msg *message.Message) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	go func() {
+		_ = router.Run(context.Background())
+	}()
+	t.Cleanup(func() {
+		_ = router.Close()
+	})
+	<-router.Running()
+
+	require.NoError(t, pubSub.Publish("flaky", message.NewMessage(watermill.NewUUID(), nil)))
+
+	assert.Eventually(t, func() bool {
+		return counterValues(t, registry, "tickets_handler_messages_processed_total")["flaky-handler"] == 1
+	}, time.Second*5, time.Millisecond*10)
+
+	assert.Equal(t, map[string]float64{"flaky-handler": 2}, counterValues(t, registry, "tickets_handler_retries_total"))
+	assert.Empty(t, counterValues(t, registry, "tickets_handler_messages_failed_total"))
+}
+
+func TestPublisherMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := metrics.New(registry)
+
+	pub := m.Publisher(failingPublisher{failTopic: "TicketBookingCanceled"})
+
+	require.NoError(t, pub.Publish("TicketBookingConfirmed", message.NewMessage("1", nil), message.NewMessage("2", nil)))
+	require.Error(t, pub.Publish("TicketBookingCanceled", message.NewMessage("3", nil)))
+
+	assert.Equal(t, map[string]float64{
+		"success/TicketBookingConfirmed": 2,
+		"error/TicketBookingCanceled":    1,
+	}, counterValues(t, registry, "tickets_messages_published_total"))
+}
+
+type failingPublisher struct {
+	failTopic string
+}
+
+func (p failingPublisher) Publish(topic string, msgs ...*message.Message) error {
+	if topic == p.failTopic {
+		return errors.New("broker unavailable")
+	}
+	return nil
+}
+
+func (p failingPublisher) Close() error {
+	return nil
+}
+
+// counterValues returns values of all series of the named counter,
+// keyed by their label values, sorted by label name, joined with "/".
+func counterValues(t *testing.T, registry *prometheus.Registry, name string) map[string]float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	values := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			labels := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetValue())
+			}
+			values[strings.Join(labels, "/")] = metric.GetCounter().GetValue()
+		}
+	}
+
+	return values
+}
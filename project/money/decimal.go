@@ -0,0 +1,156 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Decimal is an exact decimal number equal to coef * 10^-scale.
+// The zero value is 0.
+type Decimal struct {
+	coef  *big.Int
+	scale int32
+}
+
+func NewDecimal(coef int64, scale int32) Decimal {
+	return Decimal{coef: big.NewInt(coef), scale: scale}
+}
+
+// ParseDecimal parses numbers in plain decimal notation, e.g. "-12.50".
+// The number of fraction digits is preserved, so "12.50" is formatted back as "12.50".
+func ParseDecimal(s string) (Decimal, error) {
+	digits := strings.TrimSpace(s)
+	if digits == "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	var scale int32
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		fraction := digits[i+1:]
+		if fraction == "" {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+		scale = int32(len(fraction))
+		digits = digits[:i] + fraction
+	}
+
+	for i, r := range digits {
+		if r >= '0' && r <= '9' {
+			continue
+		}
+		if i == 0 && (r == '-' || r == '+') && len(digits) > 1 {
+			continue
+		}
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	coef, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	return Decimal{coef: coef, scale: scale}, nil
+}
+
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (d Decimal) coefficient() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+// rescale returns the coefficient of d expressed with the given, not smaller, scale.
+func (d Decimal) rescale(scale int32) *big.Int {
+	coef := new(big.Int).Set(d.coefficient())
+	if scale > d.scale {
+		factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale-d.scale)), nil)
+		coef.Mul(coef, factor)
+	}
+	return coef
+}
+
+func (d Decimal) Add(other Decimal) Decimal {
+	scale := max(d.scale, other.scale)
+	return Decimal{
+		coef:  new(big.Int).Add(d.rescale(scale), other.rescale(scale)),
+		scale: scale,
+	}
+}
+
+func (d Decimal) Sub(other Decimal) Decimal {
+	return d.Add(other.Neg())
+}
+
+func (d Decimal) Mul(other Decimal) Decimal {
+	return Decimal{
+		coef:  new(big.Int).Mul(d.coefficient(), other.coefficient()),
+		scale: d.scale + other.scale,
+	}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{
+		coef:  new(big.Int).Neg(d.coefficient()),
+		scale: d.scale,
+	}
+}
+
+func (d Decimal) Cmp(other Decimal) int {
+	scale := max(d.scale, other.scale)
+	return d.rescale(scale).Cmp(other.rescale(scale))
+}
+
+func (d Decimal) Sign() int {
+	return d.coefficient().Sign()
+}
+
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+func (d Decimal) String() string {
+	coef := d.coefficient()
+	if d.scale <= 0 {
+		return d.rescale(0).String()
+	}
+
+	digits := new(big.Int).Abs(coef).String()
+	if pad := int(d.scale) + 1 - len(digits); pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+
+	point := len(digits) - int(d.scale)
+	s := digits[:point] + "." + digits[point:]
+	if coef.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON accepts both JSON strings, as sent by the gateway, and numbers.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+
+	parsed, err := ParseDecimal(string(data))
+	if err != nil {
+		return err
+	}
+
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,62 @@
+package money
+
+import (
+	"fmt"
+)
+
+// Money is an exact amount in a currency. It marshals to the gateway's
+// format: {"amount": "49.90", "currency": "EUR"}.
+type Money struct {
+	Amount   Decimal  `json:"amount"`
+	Currency Currency `json:"currency"`
+}
+
+func New(amount string, currency string) (Money, error) {
+	a, err := ParseDecimal(amount)
+	if err != nil {
+		return Money{}, err
+	}
+
+	c, err := ParseCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{Amount: a, Currency: c}, nil
+}
+
+func (m Money) Validate() error {
+	if !m.Currency.Valid() {
+		return fmt.Errorf("unknown currency %q", m.Currency)
+	}
+
+	return nil
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("cannot add %s to %s", other.Currency, m.Currency)
+	}
+
+	return Money{Amount: m.Amount.Add(other.Amount), Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("cannot subtract %s from %s", other.Currency, m.Currency)
+	}
+
+	return Money{Amount: m.Amount.Sub(other.Amount), Currency: m.Currency}, nil
+}
+
+func (m Money) Mul(quantity int64) Money {
+	return Money{Amount: m.Amount.Mul(NewDecimal(quantity, 0)), Currency: m.Currency}
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount.Sign() > 0
+}
+
+func (m Money) String() string {
+	return m.Amount.String() + " " + m.Currency.String()
+}
@@ -0,0 +1,59 @@
+package money_test
+
+import (
+	"encoding/json"
+	"testing"
+	"tickets/money"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoney_JSONRoundTrip(t *testing.T) {
+	payloads := []string{
+		`{"amount":"49.90","currency":"EUR"}`,
+		`{"amount":"0.05","currency":"USD"}`,
+		`{"amount":"-120","currency":"PLN"}`,
+	}
+
+	for _, payload := range payloads {
+		t.Run(payload, func(t *testing.T) {
+			m := money.Money{}
+			require.NoError(t, json.Unmarshal([]byte(payload), &m))
+			require.NoError(t, m.Validate())
+
+			out, err := json.Marshal(m)
+			require.NoError(t, err)
+			assert.JSONEq(t, payload, string(out))
+		})
+	}
+}
+
+func TestMoney_InvalidInput(t *testing.T) {
+	m := money.Money{}
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":"12,50","currency":"EUR"}`), &m))
+
+	require.NoError(t, json.Unmarshal([]byte(`{"amount":"12.50","currency":"EURO"}`), &m))
+	assert.Error(t, m.Validate())
+}
+
+func TestMoney_Arithmetic(t *testing.T) {
+	a, err := money.New("10.10", "EUR")
+	require.NoError(t, err)
+	b, err := money.New("0.2", "eur")
+	require.NoError(t, err)
+
+	sum, err := a.Add(b)
+	require.NoError(t, err)
+	assert.Equal(t, "10.30 EUR", sum.String())
+
+	diff, err := b.Sub(a)
+	require.NoError(t, err)
+	assert.Equal(t, "-9.90 EUR", diff.String())
+	assert.False(t, diff.IsPositive())
+
+	assert.Equal(t, "30.30 EUR", a.Mul(3).String())
+
+	_, err = a.Add(money.Money{Amount: money.NewDecimal(1, 0), Currency: "USD"})
+	assert.Error(t, err)
+}
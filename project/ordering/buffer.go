@@ -0,0 +1,394 @@
+package ordering
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	SequenceKeyMetadata = "sequence_key"
+	SequenceMetadata    = "sequence"
+
+	// deferredAtMetadata is when a released message was deferred, in Unix milliseconds.
+	deferredAtMetadata = "ordering_deferred_at"
+	// timedOutMetadata marks messages released because their predecessor didn't arrive in time.
+	timedOutMetadata = "ordering_timed_out"
+)
+
+// DefaultStateTTL is the default StateTTL, and the TTL of the Sequencer keys.
+const DefaultStateTTL = time.Hour * 24 * 7
+
+// SetSequenceKey marks msg to be numbered within key when it's published
+// with a SequencingPublisher.
+func SetSequenceKey(msg *message.Message, key string) {
+	msg.Metadata.Set(SequenceKeyMetadata, key)
+}
+
+// SetSequence marks msg as the seq-th message of key.
+func SetSequence(msg *message.Message, key string, seq int64) {
+	msg.Metadata.Set(SequenceKeyMetadata, key)
+	msg.Metadata.Set(SequenceMetadata, strconv.FormatInt(seq, 10))
+}
+
+const (
+	OutcomeInOrder   = "in_order"
+	OutcomeDeferred  = "deferred"
+	OutcomeReordered = "reordered"
+	OutcomeTimedOut  = "timed_out"
+	OutcomeLate      = "late"
+)
+
+type Config struct {
+	// Scopes maps handler names to the scope their messages are ordered in.
+	// Handlers consuming one stream of events each, but sharing the state
+	// they change, must share the scope. Other handlers are not ordered.
+	Scopes map[string]string
+	// Timeout is how long a message is deferred waiting for its predecessor
+	// before it's handled anyway.
+	Timeout time.Duration
+	// PollInterval is how often deferred messages are checked for Timeout.
+	PollInterval time.Duration
+	// StateTTL is how long the last handled sequence number of a key, and
+	// the messages deferred for it, are kept.
+	StateTTL time.Duration
+
+	// Observe, if not nil, is called for every sequenced message with one
+	// of the Outcome constants and the time it was deferred.
+	Observe func(handler string, outcome string, wait time.Duration)
+}
+
+func (c *Config) setDefaults() {
+	if c.Timeout == 0 {
+		c.Timeout = time.Second * 30
+	}
+	if c.PollInterval == 0 {
+		c.PollInterval = time.Second
+	}
+	if c.StateTTL == 0 {
+		c.StateTTL = DefaultStateTTL
+	}
+}
+
+// deferScript keeps the message as deferred, unless its predecessor was
+// handled already. It returns the last handled sequence number, or -1 if
+// the message was deferred.
+var deferScript = redis.NewScript(`
+local last = tonumber(redis.call("GET", KEYS[1]) or "0")
+if tonumber(ARGV[1]) <= last + 1 then
+	return last
+end
+redis.call("HSET", KEYS[2], ARGV[1], ARGV[2])
+redis.call("PEXPIRE", KEYS[2], ARGV[3])
+redis.call("ZADD", KEYS[3], ARGV[4], ARGV[5])
+return -1
+`)
+
+// advanceScript sets the last handled sequence number, unless a later one
+// was handled already, and returns the message deferred for the next one.
+var advanceScript = redis.NewScript(`
+local last = tonumber(redis.call("GET", KEYS[1]) or "0")
+if tonumber(ARGV[1]) > last then
+	last = tonumber(ARGV[1])
+	redis.call("SET", KEYS[1], last, "PX", ARGV[2])
+end
+return redis.call("HGET", KEYS[2], tostring(last + 1))
+`)
+
+// forgetScript removes a deferred message once it was published again.
+var forgetScript = redis.NewScript(`
+redis.call("HDEL", KEYS[1], ARGV[1])
+redis.call("ZREM", KEYS[2], ARGV[2])
+return 0
+`)
+
+type deferredMessage struct {
+	UUID     string            `json:"uuid"`
+	Topic    string            `json:"topic"`
+	Metadata map[string]string `json:"metadata"`
+	Payload  []byte            `json:"payload"`
+}
+
+// Buffer defers messages which arrived ahead of their predecessor in the
+// sequence of their key, until the predecessor was handled or Timeout
+// passed. Messages without a sequence number, or which are late because a
+// successor was handled already, are handled right away.
+//
+// Deferred messages are acked and kept in Redis. They are published to
+// their topic again once the predecessor was handled, or by Run once they
+// timed out, so handlers of the same stream don't wait for them. The
+// middleware must be added before the idempotency middleware, so deferred
+// messages aren't marked as handled.
+//
+// The last handled sequence number of every key is kept in Redis, so it's
+// shared by all instances.
+type Buffer struct {
+	rdb       redis.UniversalClient
+	prefix    string
+	publisher message.Publisher
+	config    Config
+	logger    watermill.LoggerAdapter
+}
+
+func NewBuffer(
+	rdb redis.UniversalClient,
+	prefix string,
+	publisher message.Publisher,
+	config Config,
+	logger watermill.LoggerAdapter,
+) *Buffer {
+	config.setDefaults()
+
+	return &Buffer{
+		rdb:       rdb,
+		prefix:    prefix,
+		publisher: publisher,
+		config:    config,
+		logger:    logger,
+	}
+}
+
+func (b *Buffer) deadlinesKey() string {
+	return b.prefix + ":deferred"
+}
+
+func (b *Buffer) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		ctx := msg.Context()
+		handlerName := message.HandlerNameFromCtx(ctx)
+
+		scope, ok := b.config.Scopes[handlerName]
+		if !ok {
+			return h(msg)
+		}
+
+		key := msg.Metadata.Get(SequenceKeyMetadata)
+		seq, err := strconv.ParseInt(msg.Metadata.Get(SequenceMetadata), 10, 64)
+		if key == "" || err != nil {
+			return h(msg)
+		}
+
+		stateKey := b.prefix + ":" + scope + ":" + key
+		logFields := watermill.LogFields{
+			"handler":      handlerName,
+			"message_uuid": msg.UUID,
+			"sequence_key": key,
+			"sequence":     seq,
+		}
+
+		var last int64
+		if msg.Metadata.Get(timedOutMetadata) == "" {
+			last, err = b.deferEarly(ctx, stateKey, message.SubscribeTopicFromCtx(ctx), msg, seq)
+			if err != nil {
+				return nil, err
+			}
+			if last < 0 {
+				b.observe(handlerName, OutcomeDeferred, 0)
+				b.logger.Debug("Deferring message until its predecessor is handled", logFields)
+				return nil, nil
+			}
+		} else {
+			last, err = b.last(ctx, stateKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var wait time.Duration
+		if deferredAt, err := strconv.ParseInt(msg.Metadata.Get(deferredAtMetadata), 10, 64); err == nil {
+			wait = time.Since(time.UnixMilli(deferredAt))
+		}
+
+		switch {
+		case seq <= last:
+			b.observe(handlerName, OutcomeLate, wait)
+		case seq == last+1 && wait == 0:
+			b.observe(handlerName, OutcomeInOrder, 0)
+		case seq == last+1:
+			b.observe(handlerName, OutcomeReordered, wait)
+		default:
+			b.observe(handlerName, OutcomeTimedOut, wait)
+			b.logger.Info("Predecessor didn't arrive in time, handling message out of order", logFields)
+		}
+
+		msgs, err := h(msg)
+		if err != nil {
+			return msgs, err
+		}
+
+		next, err := advanceScript.Run(ctx, b.rdb, []string{stateKey, stateKey + ":deferred"}, seq, b.config.StateTTL.Milliseconds()).Text()
+		if errors.Is(err, redis.Nil) {
+			return msgs, nil
+		}
+		if err != nil {
+			return msgs, fmt.Errorf("cannot save sequence %d of %s: %w", seq, key, err)
+		}
+
+		// The successor is released at its timeout if it can't be released now.
+		err = b.release(ctx, stateKey, []byte(next), false)
+		if err != nil {
+			b.logger.Error("Cannot release deferred successor", err, logFields)
+		}
+
+		return msgs, nil
+	}
+}
+
+func (b *Buffer) observe(handler string, outcome string, wait time.Duration) {
+	if b.config.Observe != nil {
+		b.config.Observe(handler, outcome, wait)
+	}
+}
+
+// deferEarly defers msg if it's ahead of its predecessor. It returns the
+// last handled sequence number, or -1 if msg was deferred.
+func (b *Buffer) deferEarly(ctx context.Context, stateKey string, topic string, msg *message.Message, seq int64) (int64, error) {
+	metadata := make(map[string]string, len(msg.Metadata)+1)
+	for k, v := range msg.Metadata {
+		metadata[k] = v
+	}
+	metadata[deferredAtMetadata] = strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	deferred, err := json.Marshal(deferredMessage{
+		UUID:     msg.UUID,
+		Topic:    topic,
+		Metadata: metadata,
+		Payload:  msg.Payload,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cannot marshal deferred message %s: %w", msg.UUID, err)
+	}
+
+	last, err := deferScript.Run(
+		ctx,
+		b.rdb,
+		[]string{stateKey, stateKey + ":deferred", b.deadlinesKey()},
+		seq,
+		deferred,
+		b.config.StateTTL.Milliseconds(),
+		time.Now().Add(b.config.Timeout).UnixMilli(),
+		deadlineMember(stateKey, seq),
+	).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("cannot defer message %s: %w", msg.UUID, err)
+	}
+
+	return last, nil
+}
+
+// release publishes the deferred message to its topic again and forgets it.
+func (b *Buffer) release(ctx context.Context, stateKey string, deferred []byte, timedOut bool) error {
+	m := deferredMessage{}
+	err := json.Unmarshal(deferred, &m)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal deferred message: %w", err)
+	}
+
+	msg := message.NewMessage(m.UUID, m.Payload)
+	for k, v := range m.Metadata {
+		msg.Metadata.Set(k, v)
+	}
+	if timedOut {
+		msg.Metadata.Set(timedOutMetadata, "true")
+	}
+
+	seq, err := strconv.ParseInt(msg.Metadata.Get(SequenceMetadata), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid sequence of deferred message %s: %w", m.UUID, err)
+	}
+
+	err = b.publisher.Publish(m.Topic, msg)
+	if err != nil {
+		return fmt.Errorf("cannot publish deferred message %s: %w", m.UUID, err)
+	}
+
+	// Published twice if forgetting fails, the copy is late and skipped.
+	err = forgetScript.Run(ctx, b.rdb, []string{stateKey + ":deferred", b.deadlinesKey()}, seq, deadlineMember(stateKey, seq)).Err()
+	if err != nil {
+		return fmt.Errorf("cannot forget deferred message %s: %w", m.UUID, err)
+	}
+
+	return nil
+}
+
+func deadlineMember(stateKey string, seq int64) string {
+	return strconv.FormatInt(seq, 10) + ":" + stateKey
+}
+
+// Run releases deferred messages which timed out every PollInterval, until
+// ctx is canceled.
+func (b *Buffer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(b.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		err := b.releaseTimedOut(ctx)
+		if err != nil && ctx.Err() == nil {
+			b.logger.Error("Cannot release timed out messages", err, nil)
+		}
+	}
+}
+
+func (b *Buffer) releaseTimedOut(ctx context.Context) error {
+	members, err := b.rdb.ZRangeByScore(ctx, b.deadlinesKey(), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Count: 100,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("cannot get timed out messages: %w", err)
+	}
+
+	for _, member := range members {
+		seq, stateKey, ok := strings.Cut(member, ":")
+		if !ok {
+			return fmt.Errorf("invalid deferred message %s", member)
+		}
+
+		deferred, err := b.rdb.HGet(ctx, stateKey+":deferred", seq).Bytes()
+		if errors.Is(err, redis.Nil) {
+			// Released meanwhile, or expired.
+			err = b.rdb.ZRem(ctx, b.deadlinesKey(), member).Err()
+			if err != nil {
+				return fmt.Errorf("cannot forget deferred message %s: %w", member, err)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot get deferred message %s: %w", member, err)
+		}
+
+		err = b.release(ctx, stateKey, deferred, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Buffer) last(ctx context.Context, stateKey string) (int64, error) {
+	last, err := b.rdb.Get(ctx, stateKey).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot get last handled sequence of %s: %w", stateKey, err)
+	}
+
+	return last, nil
+}
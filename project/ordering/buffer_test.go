@@ -0,0 +1,184 @@
+package ordering_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"tickets/ordering"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type observation struct {
+	handler string
+	outcome string
+}
+
+type testRouter struct {
+	pubSub *gochannel.GoChannel
+	rdb    *redis.Client
+
+	mu       sync.Mutex
+	handled  []string
+	observed []observation
+}
+
+func newTestRouter(t *testing.T, timeout time.Duration) *testRouter {
+	logger := watermill.NopLogger{}
+	tr := &testRouter{
+		pubSub: gochannel.NewGoChannel(gochannel.Config{OutputChannelBuffer: 100}, logger),
+		rdb:    redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}),
+	}
+
+	router, err := message.NewRouter(message.RouterConfig{}, logger)
+	require.NoError(t, err)
+
+	buffer := ordering.NewBuffer(tr.rdb, "ordering", tr.pubSub, ordering.Config{
+		Scopes: map[string]string{
+			"confirmed": "tracker",
+			"canceled":  "tracker",
+		},
+		Timeout:      timeout,
+		PollInterval: time.Millisecond * 10,
+		Observe: func(handler string, outcome string, wait time.Duration) {
+			tr.mu.Lock()
+			defer tr.mu.Unlock()
+			tr.observed = append(tr.observed, observation{handler, outcome})
+		},
+	}, logger)
+	router.AddMiddleware(buffer.Middleware)
+
+	for _, name := range []string{"confirmed", "canceled"} {
+		name := name
+		router.AddNoPublisherHandler(name, name, tr.pubSub, func(msg *message.Message) error {
+			tr.mu.Lock()
+			defer tr.mu.Unlock()
+			tr.handled = append(tr.handled, name+":"+msg.Metadata.Get(ordering.SequenceKeyMetadata))
+			return nil
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_ = router.Run(ctx)
+	}()
+	go func() {
+		_ = buffer.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		_ = router.Close()
+	})
+	<-router.Running()
+
+	return tr
+}
+
+func (tr *testRouter) publish(t *testing.T, topic string, key string, seq int64) {
+	msg := message.NewMessage(watermill.NewUUID(), nil)
+	ordering.SetSequence(msg, key, seq)
+	require.NoError(t, tr.pubSub.Publish(topic, msg))
+}
+
+func (tr *testRouter) results() ([]string, []observation) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return append([]string(nil), tr.handled...), append([]observation(nil), tr.observed...)
+}
+
+func TestBuffer_reorders(t *testing.T) {
+	tr := newTestRouter(t, time.Second*5)
+
+	tr.publish(t, "canceled", "ticket-1", 2)
+
+	// The cancellation is deferred until the confirmation is handled.
+	assert.Eventually(t, func() bool {
+		_, observed := tr.results()
+		return len(observed) == 1
+	}, time.Second*5, time.Millisecond*10)
+	handled, _ := tr.results()
+	assert.Empty(t, handled)
+
+	tr.publish(t, "confirmed", "ticket-1", 1)
+
+	assert.Eventually(t, func() bool {
+		handled, _ := tr.results()
+		return len(handled) == 2
+	}, time.Second*5, time.Millisecond*10)
+
+	handled, observed := tr.results()
+	assert.Equal(t, []string{"confirmed:ticket-1", "canceled:ticket-1"}, handled)
+	assert.Equal(t, []observation{
+		{"canceled", ordering.OutcomeDeferred},
+		{"confirmed", ordering.OutcomeInOrder},
+		{"canceled", ordering.OutcomeReordered},
+	}, observed)
+}
+
+func TestBuffer_timeout(t *testing.T) {
+	tr := newTestRouter(t, time.Millisecond*50)
+
+	tr.publish(t, "canceled", "ticket-1", 2)
+
+	assert.Eventually(t, func() bool {
+		handled, _ := tr.results()
+		return len(handled) == 1
+	}, time.Second*5, time.Millisecond*10)
+
+	// The confirmation arriving after its successor was handled is late.
+	tr.publish(t, "confirmed", "ticket-1", 1)
+
+	assert.Eventually(t, func() bool {
+		handled, _ := tr.results()
+		return len(handled) == 2
+	}, time.Second*5, time.Millisecond*10)
+
+	handled, observed := tr.results()
+	assert.Equal(t, []string{"canceled:ticket-1", "confirmed:ticket-1"}, handled)
+	assert.Equal(t, []observation{
+		{"canceled", ordering.OutcomeDeferred},
+		{"canceled", ordering.OutcomeTimedOut},
+		{"confirmed", ordering.OutcomeLate},
+	}, observed)
+}
+
+func TestBuffer_keys_are_independent(t *testing.T) {
+	tr := newTestRouter(t, time.Second*5)
+
+	tr.publish(t, "confirmed", "ticket-1", 1)
+	tr.publish(t, "confirmed", "ticket-2", 1)
+	tr.publish(t, "canceled", "ticket-2", 2)
+
+	assert.Eventually(t, func() bool {
+		handled, _ := tr.results()
+		return len(handled) == 3
+	}, time.Second*5, time.Millisecond*10)
+
+	_, observed := tr.results()
+	for _, o := range observed {
+		assert.NotEqual(t, ordering.OutcomeTimedOut, o.outcome)
+	}
+}
+
+func TestBuffer_deferring_doesnt_block_the_handler(t *testing.T) {
+	tr := newTestRouter(t, time.Second*5)
+
+	tr.publish(t, "canceled", "ticket-1", 2)
+	tr.publish(t, "canceled", "ticket-2", 1)
+
+	// The second cancellation is handled while the first one waits for its confirmation.
+	assert.Eventually(t, func() bool {
+		handled, _ := tr.results()
+		return len(handled) == 1
+	}, time.Second, time.Millisecond*10)
+
+	handled, _ := tr.results()
+	assert.Equal(t, []string{"canceled:ticket-2"}, handled)
+}
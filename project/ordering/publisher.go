@@ -0,0 +1,60 @@
+package ordering
+
+import (
+	"strconv"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// SequencingPublisher numbers the messages marked with SetSequenceKey as it
+// publishes them. Used by the outbox forwarder, it numbers events once they
+// reach the broker, so they can be stored while Redis is down.
+//
+// Messages numbered already, like those released by the Buffer, are
+// published as they are.
+type SequencingPublisher struct {
+	publisher message.Publisher
+	sequencer *Sequencer
+}
+
+func NewSequencingPublisher(publisher message.Publisher, sequencer *Sequencer) *SequencingPublisher {
+	return &SequencingPublisher{
+		publisher: publisher,
+		sequencer: sequencer,
+	}
+}
+
+// Publish publishes messages one by one, as each of them is numbered
+// separately. The number of a message which failed is given back.
+func (p *SequencingPublisher) Publish(topic string, messages ...*message.Message) error {
+	for _, msg := range messages {
+		key := msg.Metadata.Get(SequenceKeyMetadata)
+		if key == "" || msg.Metadata.Get(SequenceMetadata) != "" {
+			err := p.publisher.Publish(topic, msg)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := p.sequencer.Assign(msg.Context(), key, func(seq int64) error {
+			msg.Metadata.Set(SequenceMetadata, strconv.FormatInt(seq, 10))
+
+			err := p.publisher.Publish(topic, msg)
+			if err != nil {
+				// Numbered again when it's retried.
+				delete(msg.Metadata, SequenceMetadata)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *SequencingPublisher) Close() error {
+	return p.publisher.Close()
+}
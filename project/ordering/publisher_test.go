@@ -0,0 +1,65 @@
+package ordering_test
+
+import (
+	"errors"
+	"testing"
+	"tickets/ordering"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingPublisher struct {
+	err       error
+	sequences []string
+}
+
+func (p *recordingPublisher) Publish(topic string, messages ...*message.Message) error {
+	if p.err != nil {
+		return p.err
+	}
+	for _, msg := range messages {
+		p.sequences = append(p.sequences, msg.Metadata.Get(ordering.SequenceMetadata))
+	}
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	return nil
+}
+
+func TestSequencingPublisher(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	publisher := &recordingPublisher{}
+	sequencing := ordering.NewSequencingPublisher(publisher, ordering.NewSequencer(rdb, "sequence", time.Hour))
+
+	newMessage := func(key string) *message.Message {
+		msg := message.NewMessage(watermill.NewUUID(), nil)
+		if key != "" {
+			ordering.SetSequenceKey(msg, key)
+		}
+		return msg
+	}
+
+	released := newMessage("")
+	ordering.SetSequence(released, "ticket-1", 7)
+
+	err := sequencing.Publish("topic", newMessage("ticket-1"), newMessage("ticket-1"), newMessage(""), released)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "", "7"}, publisher.sequences)
+
+	publisher.err = errors.New("broker down")
+	failed := newMessage("ticket-1")
+	require.Error(t, sequencing.Publish("topic", failed))
+	assert.Empty(t, failed.Metadata.Get(ordering.SequenceMetadata), "failed message should be numbered again")
+
+	publisher.err = nil
+	require.NoError(t, sequencing.Publish("topic", failed))
+	assert.Equal(t, "3", publisher.sequences[len(publisher.sequences)-1], "number of the failed message should be given back")
+}
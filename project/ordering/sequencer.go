@@ -0,0 +1,74 @@
+package ordering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// nextScript assigns the next sequence number and keeps the key for ttl after it.
+var nextScript = redis.NewScript(`
+local seq = redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[1])
+return seq
+`)
+
+// releaseScript gives seq back, unless a later number was assigned already.
+var releaseScript = redis.NewScript(`
+if tonumber(redis.call("GET", KEYS[1]) or "0") == tonumber(ARGV[1]) then
+	redis.call("DECR", KEYS[1])
+	return 1
+end
+return 0
+`)
+
+// Sequencer assigns consecutive sequence numbers per key, starting at 1.
+// Numbers are kept in Redis, so they are shared by all instances.
+//
+// A key expires ttl after its last number was assigned and starts at 1
+// again. It must be the StateTTL of the Buffer ordering the messages, so
+// both forget a key at the same time.
+type Sequencer struct {
+	rdb    redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func NewSequencer(rdb redis.UniversalClient, prefix string, ttl time.Duration) *Sequencer {
+	return &Sequencer{
+		rdb:    rdb,
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+// Assign assigns the next number of key and calls write with it, the number
+// is given back if write fails. A number given back while the next one was
+// assigned already leaves a gap, and the message with the next number waits
+// for the Buffer timeout.
+func (s *Sequencer) Assign(ctx context.Context, key string, write func(seq int64) error) error {
+	seq, err := nextScript.Run(ctx, s.rdb, []string{s.key(key)}, s.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return fmt.Errorf("cannot assign sequence number of %s: %w", key, err)
+	}
+
+	err = write(seq)
+	if err == nil {
+		return nil
+	}
+
+	// The write failed anyway, so the context may be canceled already.
+	releaseErr := releaseScript.Run(context.WithoutCancel(ctx), s.rdb, []string{s.key(key)}, seq).Err()
+	if releaseErr != nil {
+		releaseErr = fmt.Errorf("cannot release sequence number %d of %s: %w", seq, key, releaseErr)
+	}
+
+	return errors.Join(err, releaseErr)
+}
+
+func (s *Sequencer) key(key string) string {
+	return s.prefix + ":" + key
+}
@@ -0,0 +1,53 @@
+package ordering_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"tickets/ordering"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequencer_Assign(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	sequencer := ordering.NewSequencer(rdb, "sequence", time.Hour)
+	ctx := context.Background()
+
+	assign := func(key string, writeErr error) (int64, error) {
+		var assigned int64
+		err := sequencer.Assign(ctx, key, func(seq int64) error {
+			assigned = seq
+			return writeErr
+		})
+		return assigned, err
+	}
+
+	seq, err := assign("ticket-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), seq)
+
+	seq, err = assign("ticket-2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), seq, "keys should be independent")
+
+	errWrite := errors.New("disk full")
+	seq, err = assign("ticket-1", errWrite)
+	assert.ErrorIs(t, err, errWrite)
+	assert.Equal(t, int64(2), seq)
+
+	seq, err = assign("ticket-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), seq, "number of the failed write should be given back")
+
+	mr.FastForward(time.Hour)
+
+	seq, err = assign("ticket-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), seq, "key should expire after ttl")
+}
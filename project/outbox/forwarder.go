@@ -0,0 +1,147 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type ForwarderConfig struct {
+	Interval  time.Duration
+	BatchSize int
+}
+
+func (c *ForwarderConfig) setDefaults() {
+	if c.Interval == 0 {
+		c.Interval = time.Millisecond * 100
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = 100
+	}
+}
+
+// Forwarder drains the outbox into the broker with at-least-once semantics:
+// an entry is removed only after it was published, and it keeps its message
+// UUID between attempts so consumers can deduplicate redeliveries.
+type Forwarder struct {
+	store     *Store
+	publisher message.Publisher
+	config    ForwarderConfig
+	logger    watermill.LoggerAdapter
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	running   sync.WaitGroup
+}
+
+func NewForwarder(
+	store *Store,
+	publisher message.Publisher,
+	config ForwarderConfig,
+	logger watermill.LoggerAdapter,
+) *Forwarder {
+	config.setDefaults()
+
+	return &Forwarder{
+		store:     store,
+		publisher: publisher,
+		config:    config,
+		logger:    logger,
+		closing:   make(chan struct{}),
+	}
+}
+
+// Run forwards entries until ctx is canceled or the forwarder is closed.
+func (f *Forwarder) Run(ctx context.Context) error {
+	f.running.Add(1)
+	defer f.running.Done()
+
+	ticker := time.NewTicker(f.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-f.closing:
+			return nil
+		case <-ticker.C:
+		}
+
+		for f.forwardBatch() {
+			if ctx.Err() != nil || f.isClosing() {
+				return nil
+			}
+		}
+	}
+}
+
+// Close stops Run and waits until the batch being forwarded is done.
+// Entries left in the store are forwarded after the next start.
+func (f *Forwarder) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.closing)
+	})
+	f.running.Wait()
+
+	return nil
+}
+
+func (f *Forwarder) isClosing() bool {
+	select {
+	case <-f.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// forwardBatch publishes one batch of pending entries and reports whether
+// there may be more entries to forward right away.
+func (f *Forwarder) forwardBatch() bool {
+	entries, err := f.store.Pending(f.config.BatchSize)
+	if err != nil {
+		f.logger.Error("Cannot read outbox", err, nil)
+		return false
+	}
+
+	for _, entry := range entries {
+		msg := message.NewMessage(entry.UUID, entry.Payload)
+		for k, v := range entry.Metadata {
+			msg.Metadata.Set(k, v)
+		}
+
+		err := f.publisher.Publish(entry.Topic, msg)
+		if err != nil {
+			// Stop on the first failure to keep the order of the remaining entries.
+			f.logBacklog("Cannot forward outbox entry", err, entry)
+			return false
+		}
+
+		err = f.store.Remove(entry)
+		if err != nil {
+			f.logger.Error("Cannot remove forwarded outbox entry", err, watermill.LogFields{
+				"message_uuid": entry.UUID,
+			})
+			return false
+		}
+	}
+
+	return len(entries) == f.config.BatchSize
+}
+
+func (f *Forwarder) logBacklog(msg string, err error, entry Entry) {
+	backlog, backlogErr := f.store.Backlog()
+	if backlogErr != nil {
+		backlog = -1
+	}
+
+	f.logger.Error(msg, err, watermill.LogFields{
+		"message_uuid": entry.UUID,
+		"topic":        entry.Topic,
+		"backlog":      backlog,
+	})
+}
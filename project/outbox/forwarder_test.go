@@ -0,0 +1,120 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"tickets/outbox"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type publisherStub struct {
+	mu        sync.Mutex
+	failing   bool
+	published []*message.Message
+}
+
+func (p *publisherStub) Publish(topic string, msgs ...*message.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failing {
+		return errors.New("broker is down")
+	}
+	p.published = append(p.published, msgs...)
+
+	return nil
+}
+
+func (p *publisherStub) Close() error {
+	return nil
+}
+
+func (p *publisherStub) setFailing(failing bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failing = failing
+}
+
+func (p *publisherStub) uuids() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	uuids := make([]string, 0, len(p.published))
+	for _, msg := range p.published {
+		uuids = append(uuids, msg.UUID)
+	}
+	return uuids
+}
+
+func TestForwarder(t *testing.T) {
+	store, _ := newStore(t)
+	publisher := &publisherStub{failing: true}
+
+	forwarder := outbox.NewForwarder(store, publisher, outbox.ForwarderConfig{
+		Interval:  time.Millisecond * 10,
+		BatchSize: 2,
+	}, watermill.NopLogger{})
+
+	publish(t, store, "1", "2", "3")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- forwarder.Run(context.Background())
+	}()
+
+	// Entries are kept while the broker is down.
+	time.Sleep(time.Millisecond * 50)
+	assert.Empty(t, publisher.uuids())
+	backlog, err := store.Backlog()
+	require.NoError(t, err)
+	assert.Equal(t, 3, backlog)
+
+	publisher.setFailing(false)
+
+	require.Eventually(t, func() bool {
+		backlog, err := store.Backlog()
+		return err == nil && backlog == 0
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, []string{"1", "2", "3"}, publisher.uuids())
+
+	require.NoError(t, forwarder.Close())
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("forwarder didn't stop")
+	}
+}
+
+func TestForwarder_keeps_metadata(t *testing.T) {
+	store, _ := newStore(t)
+	publisher := &publisherStub{}
+
+	forwarder := outbox.NewForwarder(store, publisher, outbox.ForwarderConfig{
+		Interval: time.Millisecond * 10,
+	}, watermill.NopLogger{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = forwarder.Run(ctx)
+	}()
+
+	publish(t, store, "1")
+
+	require.Eventually(t, func() bool {
+		return len(publisher.uuids()) == 1
+	}, time.Second, time.Millisecond*10)
+
+	publisher.mu.Lock()
+	defer publisher.mu.Unlock()
+	assert.Equal(t, "correlation-1", publisher.published[0].Metadata.Get("correlation_id"))
+	assert.Equal(t, `{"id":"1"}`, string(publisher.published[0].Payload))
+}
@@ -0,0 +1,200 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// quarantineDir is the subdirectory corrupt entries are moved to.
+const quarantineDir = "quarantine"
+
+// Entry is a message waiting in the outbox to be forwarded to the broker.
+type Entry struct {
+	Topic    string            `json:"topic"`
+	UUID     string            `json:"uuid"`
+	Metadata map[string]string `json:"metadata"`
+	Payload  []byte            `json:"payload"`
+
+	name string
+}
+
+// Store is a file-backed outbox. Every message is kept in its own file until
+// the forwarder removes it, so it survives both broker outages and restarts.
+//
+// Store implements message.Publisher, so it can be used anywhere a broker
+// publisher is expected.
+type Store struct {
+	dir    string
+	logger watermill.LoggerAdapter
+
+	mu  sync.Mutex
+	seq uint64
+}
+
+func NewStore(dir string, logger watermill.LoggerAdapter) (*Store, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("outbox dir is required")
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create outbox dir: %w", err)
+	}
+
+	return &Store{dir: dir, logger: logger}, nil
+}
+
+func (s *Store) Publish(topic string, msgs ...*message.Message) error {
+	for _, msg := range msgs {
+		err := s.add(Entry{
+			Topic:    topic,
+			UUID:     msg.UUID,
+			Metadata: msg.Metadata,
+			Payload:  msg.Payload,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+func (s *Store) add(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("cannot marshal outbox entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Names sort in insertion order, which keeps the forwarding order stable.
+	s.seq++
+	name := fmt.Sprintf("%020d-%010d-%s.json", time.Now().UnixNano(), s.seq, entry.UUID)
+
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("cannot create outbox entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write outbox entry: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+	if err != nil {
+		return fmt.Errorf("cannot store outbox entry: %w", err)
+	}
+
+	return nil
+}
+
+// Pending returns up to limit oldest entries, in the order they were added.
+// Corrupt entries are moved to the quarantine subdirectory and skipped, so
+// they don't stall the entries after them.
+func (s *Store) Pending(limit int) ([]Entry, error) {
+	names, err := s.names()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(names))
+	for _, name := range names {
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read outbox entry %s: %w", name, err)
+		}
+
+		entry := Entry{}
+		err = json.Unmarshal(data, &entry)
+		if err != nil {
+			s.quarantine(name, err)
+			continue
+		}
+		entry.name = name
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (s *Store) quarantine(name string, reason error) {
+	fields := watermill.LogFields{"entry": name}
+
+	err := os.MkdirAll(filepath.Join(s.dir, quarantineDir), 0o755)
+	if err == nil {
+		err = os.Rename(filepath.Join(s.dir, name), filepath.Join(s.dir, quarantineDir, name))
+	}
+	if err != nil {
+		// The entry is skipped anyway, it's quarantined again on the next read.
+		s.logger.Error("Cannot quarantine corrupt outbox entry", errors.Join(reason, err), fields)
+		return
+	}
+
+	s.logger.Error("Quarantined corrupt outbox entry", reason, fields)
+}
+
+func (s *Store) Remove(entry Entry) error {
+	err := os.Remove(filepath.Join(s.dir, entry.name))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove outbox entry %s: %w", entry.name, err)
+	}
+
+	return nil
+}
+
+// Backlog returns the number of entries not yet forwarded.
+func (s *Store) Backlog() (int, error) {
+	names, err := s.names()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(names), nil
+}
+
+func (s *Store) names() ([]string, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list outbox dir: %w", err)
+	}
+
+	names := make([]string, 0, len(dirEntries))
+	for _, e := range dirEntries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
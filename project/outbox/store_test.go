@@ -0,0 +1,117 @@
+package outbox_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"tickets/outbox"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStore(t *testing.T) (*outbox.Store, string) {
+	dir := t.TempDir()
+
+	store, err := outbox.NewStore(dir, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	return store, dir
+}
+
+func publish(t *testing.T, store *outbox.Store, uuids ...string) {
+	for _, uuid := range uuids {
+		msg := message.NewMessage(uuid, []byte(`{"id":"`+uuid+`"}`))
+		msg.Metadata.Set("correlation_id", "correlation-"+uuid)
+
+		require.NoError(t, store.Publish("TicketBookingConfirmed", msg))
+	}
+}
+
+func uuidsOf(entries []outbox.Entry) []string {
+	uuids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		uuids = append(uuids, e.UUID)
+	}
+	return uuids
+}
+
+func TestStore(t *testing.T) {
+	store, _ := newStore(t)
+
+	publish(t, store, "1", "2", "3")
+
+	entries, err := store.Pending(2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, uuidsOf(entries))
+	assert.Equal(t, outbox.Entry{
+		Topic:    "TicketBookingConfirmed",
+		UUID:     "1",
+		Metadata: map[string]string{"correlation_id": "correlation-1"},
+		Payload:  []byte(`{"id":"1"}`),
+	}, withoutName(entries[0]))
+
+	require.NoError(t, store.Remove(entries[0]))
+	// Removing an entry twice, e.g. after a failed removal was retried, is fine.
+	require.NoError(t, store.Remove(entries[0]))
+
+	backlog, err := store.Backlog()
+	require.NoError(t, err)
+	assert.Equal(t, 2, backlog)
+
+	entries, err = store.Pending(0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "3"}, uuidsOf(entries))
+}
+
+func TestStore_survives_restart(t *testing.T) {
+	store, dir := newStore(t)
+	publish(t, store, "1", "2")
+
+	restarted, err := outbox.NewStore(dir, watermill.NopLogger{})
+	require.NoError(t, err)
+	publish(t, restarted, "3")
+
+	entries, err := restarted.Pending(0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, uuidsOf(entries))
+}
+
+func TestStore_quarantines_corrupt_entries(t *testing.T) {
+	store, dir := newStore(t)
+	publish(t, store, "1")
+
+	// A name sorting between the entries, as if written between them.
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, names, 1)
+	corrupt := filepath.Base(names[0]) + "-corrupt.json"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, corrupt), []byte(`{"topic":`), 0o644))
+
+	// Temporary files of entries being written are not entries yet.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".tmp-1"), []byte(`{`), 0o644))
+
+	publish(t, store, "2")
+
+	entries, err := store.Pending(2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, uuidsOf(entries))
+
+	assert.FileExists(t, filepath.Join(dir, "quarantine", corrupt))
+	assert.NoFileExists(t, filepath.Join(dir, corrupt))
+
+	backlog, err := store.Backlog()
+	require.NoError(t, err)
+	assert.Equal(t, 2, backlog)
+}
+
+func withoutName(e outbox.Entry) outbox.Entry {
+	return outbox.Entry{
+		Topic:    e.Topic,
+		UUID:     e.UUID,
+		Metadata: e.Metadata,
+		Payload:  e.Payload,
+	}
+}
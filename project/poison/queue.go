@@ -0,0 +1,153 @@
+package poison
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/redis/go-redis/v9"
+)
+
+// Topic is the stream messages which could not be handled are moved to.
+const Topic = "tickets.poison"
+
+// AttemptsKey is the metadata key holding the number of times a handler tried to handle a message.
+const AttemptsKey = "attempts_poisoned"
+
+var ErrNotFound = errors.New("poisoned message not found")
+
+type Message struct {
+	ID         string            `json:"id"`
+	UUID       string            `json:"uuid"`
+	Reason     string            `json:"reason"`
+	Topic      string            `json:"topic"`
+	Handler    string            `json:"handler"`
+	Subscriber string            `json:"subscriber"`
+	Attempts   int               `json:"attempts"`
+	Metadata   map[string]string `json:"metadata"`
+	Payload    json.RawMessage   `json:"payload"`
+}
+
+// Queue gives access to messages in the poison queue stream.
+type Queue struct {
+	rdb          redis.UniversalClient
+	publisher    message.Publisher
+	unmarshaller redisstream.Unmarshaller
+}
+
+// NewQueue creates a Queue. Requeued messages are published with publisher.
+func NewQueue(rdb redis.UniversalClient, publisher message.Publisher) *Queue {
+	return &Queue{
+		rdb:          rdb,
+		publisher:    publisher,
+		unmarshaller: redisstream.DefaultMarshallerUnmarshaller{},
+	}
+}
+
+func (q *Queue) List(ctx context.Context, limit int64) ([]Message, error) {
+	entries, err := q.rdb.XRangeN(ctx, Topic, "-", "+", limit).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list poison queue: %w", err)
+	}
+
+	msgs := make([]Message, 0, len(entries))
+	for _, entry := range entries {
+		msg, err := q.toMessage(entry)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
+}
+
+func (q *Queue) Get(ctx context.Context, id string) (Message, error) {
+	entries, err := q.rdb.XRange(ctx, Topic, id, id).Result()
+	if err != nil {
+		return Message{}, fmt.Errorf("cannot get poisoned message %s: %w", id, err)
+	}
+	if len(entries) == 0 {
+		return Message{}, ErrNotFound
+	}
+
+	return q.toMessage(entries[0])
+}
+
+// Requeue publishes the message back to the topic it was poisoned on and removes it from the queue.
+func (q *Queue) Requeue(ctx context.Context, id string) error {
+	poisoned, err := q.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	msg := message.NewMessage(poisoned.UUID, []byte(poisoned.Payload))
+	for k, v := range poisoned.Metadata {
+		switch k {
+		case middleware.ReasonForPoisonedKey, middleware.PoisonedTopicKey,
+			middleware.PoisonedHandlerKey, middleware.PoisonedSubscriberKey, AttemptsKey:
+			continue
+		}
+		msg.Metadata.Set(k, v)
+	}
+
+	err = q.publisher.Publish(poisoned.Topic, msg)
+	if err != nil {
+		return fmt.Errorf("cannot requeue poisoned message %s: %w", id, err)
+	}
+
+	return q.Remove(ctx, id)
+}
+
+func (q *Queue) Remove(ctx context.Context, id string) error {
+	removed, err := q.rdb.XDel(ctx, Topic, id).Result()
+	if err != nil {
+		return fmt.Errorf("cannot remove poisoned message %s: %w", id, err)
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Purge removes all messages from the queue and returns how many were removed.
+func (q *Queue) Purge(ctx context.Context) (int64, error) {
+	removed, err := q.rdb.XTrimMaxLen(ctx, Topic, 0).Result()
+	if err != nil {
+		return 0, fmt.Errorf("cannot purge poison queue: %w", err)
+	}
+
+	return removed, nil
+}
+
+func (q *Queue) toMessage(entry redis.XMessage) (Message, error) {
+	msg, err := q.unmarshaller.Unmarshal(entry.Values)
+	if err != nil {
+		return Message{}, fmt.Errorf("cannot unmarshal poisoned message %s: %w", entry.ID, err)
+	}
+
+	payload := json.RawMessage(msg.Payload)
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(string(msg.Payload))
+	}
+
+	attempts, _ := strconv.Atoi(msg.Metadata.Get(AttemptsKey))
+
+	return Message{
+		ID:         entry.ID,
+		UUID:       msg.UUID,
+		Reason:     msg.Metadata.Get(middleware.ReasonForPoisonedKey),
+		Topic:      msg.Metadata.Get(middleware.PoisonedTopicKey),
+		Handler:    msg.Metadata.Get(middleware.PoisonedHandlerKey),
+		Subscriber: msg.Metadata.Get(middleware.PoisonedSubscriberKey),
+		Attempts:   attempts,
+		Metadata:   msg.Metadata,
+		Payload:    payload,
+	}, nil
+}
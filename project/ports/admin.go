@@ -0,0 +1,28 @@
+package ports
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminAuth lets through only requests with the admin token as their bearer
+// token. With an empty token, all requests are rejected.
+func AdminAuth(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			given, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if token == "" || !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="admin"`)
+				return problem(c, Problem{
+					Status: http.StatusUnauthorized,
+					Detail: "A valid admin token is required.",
+				})
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package ports
+
+import (
+	"github.com/ThreeDotsLabs/go-event-driven/common/log"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// CorrelationID takes the correlation ID from the request header, or generates
+// one when it's missing, and stores it in the request context and the logger.
+// The ID is echoed in the response header.
+//
+// The echo of commonHTTP.NewEcho takes the correlation ID from the request
+// header too, so the generated ID is set there for it to keep.
+func CorrelationID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		correlationID := c.Request().Header.Get(log.CorrelationIDHttpHeader)
+		if correlationID == "" {
+			correlationID = "gen_" + uuid.NewString()
+			c.Request().Header.Set(log.CorrelationIDHttpHeader, correlationID)
+		}
+
+		ctx := log.ContextWithCorrelationID(c.Request().Context(), correlationID)
+		ctx = log.ToContext(ctx, logrus.WithFields(logrus.Fields{"correlation_id": correlationID}))
+		c.SetRequest(c.Request().WithContext(ctx))
+
+		c.Response().Header().Set(log.CorrelationIDHttpHeader, correlationID)
+
+		return next(c)
+	}
+}
@@ -0,0 +1,59 @@
+package ports_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"tickets/ports"
+
+	commonHTTP "github.com/ThreeDotsLabs/go-event-driven/common/http"
+	"github.com/ThreeDotsLabs/go-event-driven/common/log"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorrelationID(t *testing.T) {
+	testCases := []struct {
+		name          string
+		correlationID string
+	}{
+		{
+			name:          "passed",
+			correlationID: "correlation-1",
+		},
+		{
+			name: "generated",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := commonHTTP.NewEcho()
+			e.Pre(ports.CorrelationID)
+
+			var handled string
+			e.GET("/", func(c echo.Context) error {
+				handled = log.CorrelationIDFromContext(c.Request().Context())
+				return c.NoContent(http.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.correlationID != "" {
+				req.Header.Set(log.CorrelationIDHttpHeader, tc.correlationID)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			responded := rec.Header().Get(log.CorrelationIDHttpHeader)
+			if tc.correlationID != "" {
+				assert.Equal(t, tc.correlationID, responded)
+			} else {
+				assert.True(t, strings.HasPrefix(responded, "gen_"), responded)
+			}
+			require.Equal(t, http.StatusNoContent, rec.Code)
+			assert.Equal(t, responded, handled)
+		})
+	}
+}
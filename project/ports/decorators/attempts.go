@@ -0,0 +1,20 @@
+package decorators
+
+import (
+	"strconv"
+	"tickets/poison"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// CountAttempts records how many times the handler was called for a message,
+// so it can be reported when the message ends up in the poison queue.
+// It must be added after the Retry middleware.
+func CountAttempts(next message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		attempts, _ := strconv.Atoi(msg.Metadata.Get(poison.AttemptsKey))
+		msg.Metadata.Set(poison.AttemptsKey, strconv.Itoa(attempts+1))
+
+		return next(msg)
+	}
+}
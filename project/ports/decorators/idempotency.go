@@ -0,0 +1,41 @@
+package decorators
+
+import (
+	"tickets/idempotency"
+
+	"github.com/ThreeDotsLabs/go-event-driven/common/log"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Idempotency skips messages already handled successfully by the same handler.
+// Message UUIDs are event ids, so redeliveries and republished events share them.
+func Idempotency(store *idempotency.Store) message.HandlerMiddleware {
+	return func(next message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			ctx := msg.Context()
+			key := message.HandlerNameFromCtx(ctx) + ":" + msg.UUID
+
+			processed, err := store.Get(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			if processed != nil {
+				log.FromContext(ctx).WithField("message_uuid", msg.UUID).Info("Skipping already handled message")
+				return nil, nil
+			}
+
+			msgs, err := next(msg)
+			if err != nil {
+				return msgs, err
+			}
+
+			err = store.Save(ctx, key, []byte("handled"))
+			if err != nil {
+				// The message was handled, failing it now would only repeat its side effects.
+				log.FromContext(ctx).WithError(err).Error("Cannot mark message as handled")
+			}
+
+			return msgs, nil
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package ports
+
+import (
+	"net/http"
+	"tickets/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+type HealthPort struct {
+	liveness  *health.Checker
+	readiness *health.Checker
+}
+
+func NewHealthPort(liveness *health.Checker, readiness *health.Checker) HealthPort {
+	return HealthPort{
+		liveness,
+		readiness,
+	}
+}
+
+func (h *HealthPort) Live(c echo.Context) error {
+	return h.report(c, h.liveness)
+}
+
+func (h *HealthPort) Ready(c echo.Context) error {
+	return h.report(c, h.readiness)
+}
+
+func (h *HealthPort) report(c echo.Context, checker *health.Checker) error {
+	report := checker.Check(c.Request().Context())
+	if !report.Up() {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
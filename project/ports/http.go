@@ -1,51 +1,158 @@
 package ports
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	backgroundworkers "tickets/background-workers"
+	"tickets/idempotency"
+	"tickets/lifecycle"
+	"tickets/metrics"
+	"tickets/money"
 	"tickets/tickets"
 
+	"github.com/ThreeDotsLabs/go-event-driven/common/log"
 	"github.com/labstack/echo/v4"
-	"github.com/sirupsen/logrus"
 )
 
+// TicketsSender publishes events of tickets, like backgroundworkers.Worker.
+type TicketsSender interface {
+	Send(ctx context.Context, msgs ...backgroundworkers.Message) []backgroundworkers.SendResult
+}
+
 type HttpPort struct {
-	w *backgroundworkers.Worker
+	w           TicketsSender
+	idempotency *idempotency.Requests
+	lifecycle   *lifecycle.Manager
+	metrics     *metrics.Metrics
 }
 
-func NewHttpPort(w *backgroundworkers.Worker) HttpPort {
+func NewHttpPort(
+	w TicketsSender,
+	idempotencyStore *idempotency.Requests,
+	lifecycleManager *lifecycle.Manager,
+	metrics *metrics.Metrics,
+) HttpPort {
 	return HttpPort{
 		w,
+		idempotencyStore,
+		lifecycleManager,
+		metrics,
 	}
 
 }
 
 type TicketsStatusRequest struct {
-	Tickets []tickets.Ticket `json:"tickets"`
+	Tickets []TicketStatus `json:"tickets"`
+}
+
+// TicketStatus is a tickets.Ticket as reported by the webhook. The amount is
+// parsed by Validate, so an invalid one is reported with its field instead
+// of failing the whole body.
+type TicketStatus struct {
+	TicketId      string         `json:"ticket_id"`
+	Status        tickets.Status `json:"status"`
+	CustomerEmail string         `json:"customer_email"`
+	Price         struct {
+		Amount   json.RawMessage `json:"amount"`
+		Currency money.Currency  `json:"currency"`
+	} `json:"price"`
+}
+
+type TicketsStatusResponse struct {
+	Accepted []string        `json:"accepted"`
+	Failed   []TicketFailure `json:"failed"`
+}
+
+type TicketFailure struct {
+	TicketId string `json:"ticket_id"`
+	// Status is 422 for tickets which can't be accepted, so retrying them
+	// is pointless, and 503 for tickets which may be accepted on retry.
+	Status int    `json:"status"`
+	Error  string `json:"error"`
 }
 
 func (h *HttpPort) TicketsStatus(c echo.Context) error {
-	correlationId := c.Request().Header.Get("Correlation-ID")
+	idempotencyKey := c.Request().Header.Get("Idempotency-Key")
+	if idempotencyKey == "" {
+		return h.ticketsStatus(c)
+	}
+
+	return h.idempotent(c, "tickets-status:"+idempotencyKey, h.ticketsStatus)
+}
 
+func (h *HttpPort) ticketsStatus(c echo.Context) error {
 	ticketsStatusRequest := TicketsStatusRequest{}
 	err := json.NewDecoder(c.Request().Body).Decode(&ticketsStatusRequest)
 	if err != nil {
-		logrus.Error(err)
-		return err
+		log.FromContext(c.Request().Context()).WithError(err).Info("Malformed tickets status request")
+		return problem(c, Problem{
+			Status: http.StatusBadRequest,
+			Title:  "Malformed request body",
+			Detail: err.Error(),
+		})
 	}
 
-	for _, ticket := range ticketsStatusRequest.Tickets {
-		h.w.Send(backgroundworkers.Message{
-			CorrelationId: correlationId,
-			Ticket:        ticket,
+	ticketsToSend, invalidParams, rejectedTickets := ticketsStatusRequest.Validate()
+	if len(invalidParams) > 0 {
+		h.metrics.RejectedTickets.Add(float64(rejectedTickets))
+		return problem(c, Problem{
+			Status:        http.StatusBadRequest,
+			Title:         "Invalid tickets status request",
+			Detail:        "One or more tickets failed validation, the request was not processed.",
+			InvalidParams: invalidParams,
 		})
+	}
+
+	msgs := make([]backgroundworkers.Message, 0, len(ticketsToSend))
+	for _, ticket := range ticketsToSend {
+		msgs = append(msgs, backgroundworkers.Message{
+			Ticket: ticket,
+		})
+	}
 
+	response := TicketsStatusResponse{
+		Accepted: []string{},
+		Failed:   []TicketFailure{},
 	}
+	unavailable := 0
+	for _, result := range h.w.Send(c.Request().Context(), msgs...) {
+		if result.Err != nil {
+			status := http.StatusUnprocessableEntity
+			if !errors.Is(result.Err, backgroundworkers.ErrInvalidTicket) {
+				status = http.StatusServiceUnavailable
+				unavailable++
+			}
 
-	return c.NoContent(http.StatusOK)
+			response.Failed = append(response.Failed, TicketFailure{
+				TicketId: result.TicketId,
+				Status:   status,
+				Error:    result.Err.Error(),
+			})
+			continue
+		}
+		response.Accepted = append(response.Accepted, result.TicketId)
+	}
+
+	switch {
+	case len(response.Failed) == 0:
+		return c.JSON(http.StatusOK, response)
+	case len(response.Accepted) == 0 && unavailable > 0:
+		// Nothing was published, the client should retry once we're available.
+		return c.JSON(http.StatusServiceUnavailable, response)
+	case len(response.Accepted) == 0:
+		return c.JSON(http.StatusUnprocessableEntity, response)
+	default:
+		return c.JSON(http.StatusMultiStatus, response)
+	}
 }
 
 func (h *HttpPort) Health(c echo.Context) error {
+	state := h.lifecycle.State()
+	if state != lifecycle.StateRunning {
+		return c.String(http.StatusServiceUnavailable, state.String())
+	}
+
 	return c.String(http.StatusOK, "ok")
 }
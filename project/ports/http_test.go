@@ -0,0 +1,125 @@
+package ports_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	backgroundworkers "tickets/background-workers"
+	"tickets/metrics"
+	"tickets/ports"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type senderStub struct {
+	errs map[string]error
+	sent []backgroundworkers.Message
+}
+
+func (s *senderStub) Send(ctx context.Context, msgs ...backgroundworkers.Message) []backgroundworkers.SendResult {
+	results := make([]backgroundworkers.SendResult, 0, len(msgs))
+	for _, msg := range msgs {
+		s.sent = append(s.sent, msg)
+		results = append(results, backgroundworkers.SendResult{
+			TicketId: msg.Ticket.TicketId,
+			Err:      s.errs[msg.Ticket.TicketId],
+		})
+	}
+	return results
+}
+
+func ticketJSON(id string) string {
+	return fmt.Sprintf(`{"ticket_id":%q,"status":"confirmed","customer_email":"user@example.com","price":{"amount":"49.90","currency":"EUR"}}`, id)
+}
+
+func postTicketsStatus(t *testing.T, sender ports.TicketsSender, body string) *httptest.ResponseRecorder {
+	port := ports.NewHttpPort(sender, nil, nil, metrics.New(prometheus.NewRegistry()))
+
+	req := httptest.NewRequest(http.MethodPost, "/tickets-status", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	err := port.TicketsStatus(echo.New().NewContext(req, rec))
+	require.NoError(t, err)
+
+	return rec
+}
+
+func TestTicketsStatus_send_results(t *testing.T) {
+	unavailable := errors.New("outbox is not writable")
+	invalid := fmt.Errorf("%w: unknown status", backgroundworkers.ErrInvalidTicket)
+
+	testCases := []struct {
+		name         string
+		errs         map[string]error
+		wantStatus   int
+		wantAccepted []string
+		wantFailed   []ports.TicketFailure
+	}{
+		{
+			name:         "all_accepted",
+			wantStatus:   http.StatusOK,
+			wantAccepted: []string{"1", "2"},
+			wantFailed:   []ports.TicketFailure{},
+		},
+		{
+			name:         "all_unavailable",
+			errs:         map[string]error{"1": unavailable, "2": unavailable},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAccepted: []string{},
+			wantFailed: []ports.TicketFailure{
+				{TicketId: "1", Status: http.StatusServiceUnavailable, Error: unavailable.Error()},
+				{TicketId: "2", Status: http.StatusServiceUnavailable, Error: unavailable.Error()},
+			},
+		},
+		{
+			name:         "all_invalid",
+			errs:         map[string]error{"1": invalid, "2": invalid},
+			wantStatus:   http.StatusUnprocessableEntity,
+			wantAccepted: []string{},
+			wantFailed: []ports.TicketFailure{
+				{TicketId: "1", Status: http.StatusUnprocessableEntity, Error: invalid.Error()},
+				{TicketId: "2", Status: http.StatusUnprocessableEntity, Error: invalid.Error()},
+			},
+		},
+		{
+			name:         "invalid_and_unavailable",
+			errs:         map[string]error{"1": invalid, "2": unavailable},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAccepted: []string{},
+			wantFailed: []ports.TicketFailure{
+				{TicketId: "1", Status: http.StatusUnprocessableEntity, Error: invalid.Error()},
+				{TicketId: "2", Status: http.StatusServiceUnavailable, Error: unavailable.Error()},
+			},
+		},
+		{
+			name:         "partially_accepted",
+			errs:         map[string]error{"2": invalid},
+			wantStatus:   http.StatusMultiStatus,
+			wantAccepted: []string{"1"},
+			wantFailed: []ports.TicketFailure{
+				{TicketId: "2", Status: http.StatusUnprocessableEntity, Error: invalid.Error()},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender := &senderStub{errs: tc.errs}
+
+			rec := postTicketsStatus(t, sender, `{"tickets":[`+ticketJSON("1")+`,`+ticketJSON("2")+`]}`)
+			assert.Equal(t, tc.wantStatus, rec.Code)
+
+			response := ports.TicketsStatusResponse{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.Equal(t, tc.wantAccepted, response.Accepted)
+			assert.Equal(t, tc.wantFailed, response.Failed)
+		})
+	}
+}
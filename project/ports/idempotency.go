@@ -0,0 +1,111 @@
+package ports
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+type storedResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+type capturingWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// idempotent runs handler once per key and replays its response to retried requests.
+// Server errors are not stored, so the request can be retried with the same key.
+// Reusing a key for a request with a different body is rejected.
+func (h *HttpPort) idempotent(c echo.Context, key string, handler echo.HandlerFunc) error {
+	ctx := c.Request().Context()
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+	fingerprint := requestFingerprint(c.Request(), body)
+
+	request, err := h.idempotency.Reserve(ctx, key, fingerprint)
+	if err != nil {
+		return err
+	}
+	if !request.Reserved {
+		if request.Fingerprint != fingerprint {
+			return problem(c, Problem{
+				Status: http.StatusUnprocessableEntity,
+				Title:  "Idempotency key reused",
+				Detail: "The Idempotency-Key was already used for a different request.",
+			})
+		}
+		if request.Response == nil {
+			return problem(c, Problem{
+				Status: http.StatusConflict,
+				Title:  "Request in progress",
+				Detail: "A request with the same Idempotency-Key is still being processed.",
+			})
+		}
+
+		response := storedResponse{}
+		err := json.Unmarshal(request.Response, &response)
+		if err != nil {
+			return err
+		}
+
+		c.Response().Header().Set("Idempotent-Replayed", "true")
+		return c.Blob(response.Status, response.ContentType, response.Body)
+	}
+
+	writer := &capturingWriter{ResponseWriter: c.Response().Writer}
+	c.Response().Writer = writer
+
+	err = handler(c)
+
+	status := c.Response().Status
+	if err != nil || !c.Response().Committed || status >= http.StatusInternalServerError {
+		releaseErr := h.idempotency.Release(context.WithoutCancel(ctx), key, fingerprint)
+		if releaseErr != nil {
+			logrus.WithError(releaseErr).Error("Cannot release idempotency key")
+		}
+		return err
+	}
+
+	response, saveErr := json.Marshal(storedResponse{
+		Status:      status,
+		ContentType: c.Response().Header().Get(echo.HeaderContentType),
+		Body:        writer.body.Bytes(),
+	})
+	if saveErr == nil {
+		saveErr = h.idempotency.Complete(context.WithoutCancel(ctx), key, fingerprint, response)
+	}
+	if saveErr != nil {
+		logrus.WithError(saveErr).Error("Cannot save idempotent response")
+	}
+
+	return nil
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
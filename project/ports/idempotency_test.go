@@ -0,0 +1,52 @@
+package ports_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"tickets/idempotency"
+	"tickets/metrics"
+	"tickets/ports"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTicketsStatus_idempotency_key(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	requests := idempotency.NewRequests(rdb, "idempotency:requests", time.Hour, time.Minute)
+
+	sender := &senderStub{}
+	port := ports.NewHttpPort(sender, requests, nil, metrics.New(prometheus.NewRegistry()))
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tickets-status", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "key-1")
+		rec := httptest.NewRecorder()
+
+		require.NoError(t, port.TicketsStatus(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	body := `{"tickets":[` + ticketJSON("1") + `]}`
+
+	first := post(body)
+	assert.Equal(t, http.StatusOK, first.Code)
+
+	retried := post(body)
+	assert.Equal(t, http.StatusOK, retried.Code)
+	assert.Equal(t, "true", retried.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, first.Body.String(), retried.Body.String())
+	assert.Len(t, sender.sent, 1)
+
+	reused := post(`{"tickets":[` + ticketJSON("2") + `]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Contains(t, reused.Body.String(), "Idempotency key reused")
+	assert.Len(t, sender.sent, 1)
+}
@@ -0,0 +1,88 @@
+package ports
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"tickets/poison"
+
+	"github.com/labstack/echo/v4"
+)
+
+type PoisonQueuePort struct {
+	queue *poison.Queue
+}
+
+func NewPoisonQueuePort(queue *poison.Queue) PoisonQueuePort {
+	return PoisonQueuePort{
+		queue,
+	}
+}
+
+func (p *PoisonQueuePort) List(c echo.Context) error {
+	limit := int64(100)
+	if l := c.QueryParam("limit"); l != "" {
+		parsed, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || parsed <= 0 {
+			return problem(c, Problem{
+				Status:        http.StatusBadRequest,
+				InvalidParams: []InvalidParam{{Name: "limit", Reason: "must be a positive integer"}},
+			})
+		}
+		limit = parsed
+	}
+
+	msgs, err := p.queue.List(c.Request().Context(), limit)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, msgs)
+}
+
+func (p *PoisonQueuePort) Get(c echo.Context) error {
+	msg, err := p.queue.Get(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return p.error(c, err)
+	}
+
+	return c.JSON(http.StatusOK, msg)
+}
+
+func (p *PoisonQueuePort) Requeue(c echo.Context) error {
+	err := p.queue.Requeue(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return p.error(c, err)
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (p *PoisonQueuePort) Remove(c echo.Context) error {
+	err := p.queue.Remove(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return p.error(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (p *PoisonQueuePort) Purge(c echo.Context) error {
+	removed, err := p.queue.Purge(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]int64{"removed": removed})
+}
+
+func (p *PoisonQueuePort) error(c echo.Context, err error) error {
+	if errors.Is(err, poison.ErrNotFound) {
+		return problem(c, Problem{
+			Status: http.StatusNotFound,
+			Detail: err.Error(),
+		})
+	}
+
+	return err
+}
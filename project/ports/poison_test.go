@@ -0,0 +1,225 @@
+package ports_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"tickets/poison"
+	"tickets/ports"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill-redisstream/pkg/redisstream"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const adminToken = "admin-token"
+
+type requeuedMessage struct {
+	topic string
+	msg   *message.Message
+}
+
+type requeuePublisher struct {
+	mu       sync.Mutex
+	requeued []requeuedMessage
+}
+
+func (p *requeuePublisher) Publish(topic string, msgs ...*message.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, msg := range msgs {
+		p.requeued = append(p.requeued, requeuedMessage{topic: topic, msg: msg})
+	}
+	return nil
+}
+
+func (p *requeuePublisher) Close() error {
+	return nil
+}
+
+type poisonQueueTest struct {
+	t         *testing.T
+	e         *echo.Echo
+	rdb       *redis.Client
+	publisher *requeuePublisher
+}
+
+func newPoisonQueueTest(t *testing.T) *poisonQueueTest {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	publisher := &requeuePublisher{}
+	port := ports.NewPoisonQueuePort(poison.NewQueue(rdb, publisher))
+
+	e := echo.New()
+	routes := e.Group("/poison-queue", ports.AdminAuth(adminToken))
+	routes.GET("/messages", port.List)
+	routes.DELETE("/messages", port.Purge)
+	routes.GET("/messages/:id", port.Get)
+	routes.DELETE("/messages/:id", port.Remove)
+	routes.POST("/messages/:id/requeue", port.Requeue)
+
+	return &poisonQueueTest{t: t, e: e, rdb: rdb, publisher: publisher}
+}
+
+// poison adds a message poisoned by the issue receipt handler and returns its stream entry ID.
+func (pt *poisonQueueTest) poison(uuid string) string {
+	publisher, err := redisstream.NewPublisher(redisstream.PublisherConfig{Client: pt.rdb}, watermill.NopLogger{})
+	require.NoError(pt.t, err)
+
+	msg := message.NewMessage(uuid, []byte(`{"ticket_id":"ticket-1"}`))
+	msg.Metadata.Set(middleware.ReasonForPoisonedKey, "receipts API is down")
+	msg.Metadata.Set(middleware.PoisonedTopicKey, "TicketBookingConfirmed")
+	msg.Metadata.Set(middleware.PoisonedHandlerKey, "issue-receipt-handler")
+	msg.Metadata.Set(poison.AttemptsKey, "11")
+	msg.Metadata.Set("correlation_id", "correlation-1")
+	require.NoError(pt.t, publisher.Publish(poison.Topic, msg))
+
+	entries, err := pt.rdb.XRange(context.Background(), poison.Topic, "-", "+").Result()
+	require.NoError(pt.t, err)
+
+	return entries[len(entries)-1].ID
+}
+
+func (pt *poisonQueueTest) do(method string, path string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	pt.e.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func (pt *poisonQueueTest) list() []poison.Message {
+	rec := pt.do(http.MethodGet, "/poison-queue/messages", adminToken)
+	require.Equal(pt.t, http.StatusOK, rec.Code)
+
+	var msgs []poison.Message
+	require.NoError(pt.t, json.Unmarshal(rec.Body.Bytes(), &msgs))
+	return msgs
+}
+
+func TestPoisonQueue_requires_admin_token(t *testing.T) {
+	pt := newPoisonQueueTest(t)
+	id := pt.poison("message-1")
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/poison-queue/messages"},
+		{http.MethodDelete, "/poison-queue/messages"},
+		{http.MethodGet, "/poison-queue/messages/" + id},
+		{http.MethodDelete, "/poison-queue/messages/" + id},
+		{http.MethodPost, "/poison-queue/messages/" + id + "/requeue"},
+	}
+
+	for _, r := range requests {
+		for _, token := range []string{"", "wrong-token"} {
+			rec := pt.do(r.method, r.path, token)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, "%s %s with token %q", r.method, r.path, token)
+		}
+	}
+
+	assert.Len(t, pt.list(), 1)
+	assert.Empty(t, pt.publisher.requeued)
+}
+
+func TestPoisonQueue_disabled_without_token(t *testing.T) {
+	e := echo.New()
+	e.GET("/poison-queue/messages", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, ports.AdminAuth(""))
+
+	req := httptest.NewRequest(http.MethodGet, "/poison-queue/messages", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer ")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestPoisonQueue_list_and_get(t *testing.T) {
+	pt := newPoisonQueueTest(t)
+	id := pt.poison("message-1")
+	pt.poison("message-2")
+
+	msgs := pt.list()
+	require.Len(t, msgs, 2)
+	assert.Equal(t, id, msgs[0].ID)
+	assert.Equal(t, "message-1", msgs[0].UUID)
+	assert.Equal(t, "receipts API is down", msgs[0].Reason)
+	assert.Equal(t, "TicketBookingConfirmed", msgs[0].Topic)
+	assert.Equal(t, "issue-receipt-handler", msgs[0].Handler)
+	assert.Equal(t, 11, msgs[0].Attempts)
+	assert.JSONEq(t, `{"ticket_id":"ticket-1"}`, string(msgs[0].Payload))
+
+	rec := pt.do(http.MethodGet, "/poison-queue/messages?limit=1", adminToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var limited []poison.Message
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &limited))
+	assert.Len(t, limited, 1)
+
+	rec = pt.do(http.MethodGet, "/poison-queue/messages?limit=0", adminToken)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = pt.do(http.MethodGet, "/poison-queue/messages/"+id, adminToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	got := poison.Message{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, msgs[0], got)
+
+	rec = pt.do(http.MethodGet, "/poison-queue/messages/0-1", adminToken)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestPoisonQueue_requeue(t *testing.T) {
+	pt := newPoisonQueueTest(t)
+	id := pt.poison("message-1")
+
+	rec := pt.do(http.MethodPost, "/poison-queue/messages/"+id+"/requeue", adminToken)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	require.Len(t, pt.publisher.requeued, 1)
+	requeued := pt.publisher.requeued[0]
+	assert.Equal(t, "TicketBookingConfirmed", requeued.topic)
+	assert.Equal(t, "message-1", requeued.msg.UUID)
+	assert.Equal(t, `{"ticket_id":"ticket-1"}`, string(requeued.msg.Payload))
+	assert.Equal(t, "correlation-1", requeued.msg.Metadata.Get("correlation_id"))
+	assert.Empty(t, requeued.msg.Metadata.Get(middleware.ReasonForPoisonedKey))
+	assert.Empty(t, requeued.msg.Metadata.Get(poison.AttemptsKey))
+
+	assert.Empty(t, pt.list())
+
+	rec = pt.do(http.MethodPost, "/poison-queue/messages/"+id+"/requeue", adminToken)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestPoisonQueue_remove_and_purge(t *testing.T) {
+	pt := newPoisonQueueTest(t)
+	id := pt.poison("message-1")
+	pt.poison("message-2")
+	pt.poison("message-3")
+
+	rec := pt.do(http.MethodDelete, "/poison-queue/messages/"+id, adminToken)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Len(t, pt.list(), 2)
+
+	rec = pt.do(http.MethodDelete, "/poison-queue/messages/"+id, adminToken)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = pt.do(http.MethodDelete, "/poison-queue/messages", adminToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"removed":2}`, rec.Body.String())
+	assert.Empty(t, pt.list())
+}
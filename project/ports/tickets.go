@@ -0,0 +1,149 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"tickets/money"
+	"tickets/readmodel"
+	"tickets/tickets"
+	"time"
+
+	"github.com/ThreeDotsLabs/go-event-driven/common/log"
+	"github.com/labstack/echo/v4"
+)
+
+type ReadModelRebuilder interface {
+	RebuildReadModel(ctx context.Context) error
+}
+
+type TicketsPort struct {
+	repo       readmodel.Repository
+	rebuilder  ReadModelRebuilder
+	rebuilding *atomic.Bool
+}
+
+func NewTicketsPort(repo readmodel.Repository, rebuilder ReadModelRebuilder) TicketsPort {
+	return TicketsPort{
+		repo,
+		rebuilder,
+		&atomic.Bool{},
+	}
+}
+
+// TicketResponse is a ticket of the read model, without the events it was
+// projected from.
+type TicketResponse struct {
+	TicketId      string         `json:"ticket_id"`
+	Status        tickets.Status `json:"status"`
+	CustomerEmail string         `json:"customer_email"`
+	Price         money.Money    `json:"price"`
+	BookedAt      time.Time      `json:"booked_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+func newTicketResponse(ticket readmodel.Ticket) TicketResponse {
+	return TicketResponse{
+		TicketId:      ticket.TicketId,
+		Status:        ticket.Status,
+		CustomerEmail: ticket.CustomerEmail,
+		Price:         ticket.Price,
+		BookedAt:      ticket.BookedAt,
+		UpdatedAt:     ticket.UpdatedAt,
+	}
+}
+
+// List returns tickets filtered by the status, email and date (YYYY-MM-DD,
+// the UTC day the ticket was booked) query params, at most limit of them.
+func (p *TicketsPort) List(c echo.Context) error {
+	filter := readmodel.Filter{
+		Status:        tickets.Status(c.QueryParam("status")),
+		CustomerEmail: c.QueryParam("email"),
+		Limit:         100,
+	}
+
+	var invalid []InvalidParam
+	if filter.Status != "" && !filter.Status.Known() {
+		invalid = append(invalid, InvalidParam{Name: "status", Reason: "must be confirmed or canceled"})
+	}
+	if date := c.QueryParam("date"); date != "" {
+		day, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			invalid = append(invalid, InvalidParam{Name: "date", Reason: "must be a date formatted as YYYY-MM-DD"})
+		}
+		filter.BookedFrom = day
+		filter.BookedTo = day.AddDate(0, 0, 1)
+	}
+	if l := c.QueryParam("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > 1000 {
+			invalid = append(invalid, InvalidParam{Name: "limit", Reason: "must be an integer between 1 and 1000"})
+		}
+		filter.Limit = limit
+	}
+	if len(invalid) > 0 {
+		return problem(c, Problem{
+			Status:        http.StatusBadRequest,
+			InvalidParams: invalid,
+		})
+	}
+
+	list, err := p.repo.List(c.Request().Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	resp := make([]TicketResponse, 0, len(list))
+	for _, ticket := range list {
+		resp = append(resp, newTicketResponse(ticket))
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (p *TicketsPort) Get(c echo.Context) error {
+	ticket, err := p.repo.Get(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, readmodel.ErrNotFound) {
+		return problem(c, Problem{
+			Status: http.StatusNotFound,
+			Detail: err.Error(),
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, newTicketResponse(ticket))
+}
+
+// Rebuild starts rebuilding the read model from the event streams in the
+// background, it outlives the request. One rebuild runs at a time.
+func (p *TicketsPort) Rebuild(c echo.Context) error {
+	if !p.rebuilding.CompareAndSwap(false, true) {
+		return problem(c, Problem{
+			Status: http.StatusConflict,
+			Detail: "the read model is already being rebuilt",
+		})
+	}
+
+	// Keeps the correlation ID and trace of the request.
+	ctx := context.WithoutCancel(c.Request().Context())
+	go func() {
+		defer p.rebuilding.Store(false)
+
+		logger := log.FromContext(ctx)
+		logger.Info("Rebuilding read model")
+
+		err := p.rebuilder.RebuildReadModel(ctx)
+		if err != nil {
+			logger.WithError(err).Error("Cannot rebuild read model")
+			return
+		}
+
+		logger.Info("Read model rebuilt")
+	}()
+
+	return c.NoContent(http.StatusAccepted)
+}
@@ -0,0 +1,143 @@
+package ports_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"tickets/ports"
+	"tickets/readmodel"
+	"tickets/tickets"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type blockingRebuilder struct {
+	started chan context.Context
+	release chan struct{}
+}
+
+func (r *blockingRebuilder) RebuildReadModel(ctx context.Context) error {
+	r.started <- ctx
+	<-r.release
+	return nil
+}
+
+func TestTicketsPort_Rebuild(t *testing.T) {
+	rebuilder := &blockingRebuilder{
+		started: make(chan context.Context, 1),
+		release: make(chan struct{}),
+	}
+	port := ports.NewTicketsPort(readmodel.NewMemoryRepository(), rebuilder)
+
+	e := echo.New()
+	e.POST("/tickets/rebuild", port.Rebuild, ports.AdminAuth(adminToken))
+
+	rebuild := func(token string) int {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		req := httptest.NewRequest(http.MethodPost, "/tickets/rebuild", nil).WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, rebuild("wrong-token"))
+
+	require.Equal(t, http.StatusAccepted, rebuild(adminToken))
+
+	var rebuildCtx context.Context
+	select {
+	case rebuildCtx = <-rebuilder.started:
+	case <-time.After(time.Second):
+		t.Fatal("rebuild didn't start")
+	}
+	assert.NoError(t, rebuildCtx.Err(), "rebuild should outlive the request")
+
+	assert.Equal(t, http.StatusConflict, rebuild(adminToken))
+
+	rebuilder.release <- struct{}{}
+	assert.Eventually(t, func() bool {
+		return rebuild(adminToken) == http.StatusAccepted
+	}, time.Second, time.Millisecond*10)
+
+	<-rebuilder.started
+	close(rebuilder.release)
+}
+
+func TestTicketsPort_List_omits_events(t *testing.T) {
+	repo := readmodel.NewMemoryRepository()
+	require.NoError(t, repo.Update(context.Background(), "ticket-1", func(readmodel.Ticket, bool) (readmodel.Ticket, error) {
+		return readmodel.Ticket{
+			TicketId: "ticket-1",
+			Status:   tickets.StatusConfirmed,
+			Events:   []readmodel.TicketEvent{{EventId: "event-1", Status: tickets.StatusConfirmed}},
+		}, nil
+	}))
+	port := ports.NewTicketsPort(repo, nil)
+
+	e := echo.New()
+	e.GET("/tickets", port.List)
+	e.GET("/tickets/:id", port.Get)
+
+	for _, path := range []string{"/tickets", "/tickets/ticket-1"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		require.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Contains(t, rec.Body.String(), `"ticket_id":"ticket-1"`, path)
+		assert.NotContains(t, rec.Body.String(), "event-1", path)
+	}
+}
+
+func TestTicketsPort_List_limit(t *testing.T) {
+	repo := readmodel.NewMemoryRepository()
+	for _, id := range []string{"ticket-1", "ticket-2"} {
+		id := id
+		require.NoError(t, repo.Update(context.Background(), id, func(readmodel.Ticket, bool) (readmodel.Ticket, error) {
+			return readmodel.Ticket{TicketId: id, Status: tickets.StatusConfirmed}, nil
+		}))
+	}
+	port := ports.NewTicketsPort(repo, nil)
+
+	e := echo.New()
+	e.GET("/tickets", port.List)
+
+	testCases := []struct {
+		query      string
+		wantStatus int
+		wantIDs    []string
+	}{
+		{query: "", wantStatus: http.StatusOK, wantIDs: []string{"ticket-1", "ticket-2"}},
+		{query: "?limit=1", wantStatus: http.StatusOK, wantIDs: []string{"ticket-1"}},
+		{query: "?limit=0", wantStatus: http.StatusBadRequest},
+		{query: "?limit=1001", wantStatus: http.StatusBadRequest},
+		{query: "?limit=all", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tickets"+tc.query, nil))
+			require.Equal(t, tc.wantStatus, rec.Code)
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var list []ports.TicketResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+			ids := make([]string, 0, len(list))
+			for _, ticket := range list {
+				ids = append(ids, ticket.TicketId)
+			}
+			assert.Equal(t, tc.wantIDs, ids)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package ports
+
+import (
+	"fmt"
+	"net/mail"
+	"tickets/tickets"
+)
+
+// Validate returns the tickets of the request, all its invalid fields and
+// the number of invalid tickets.
+func (r TicketsStatusRequest) Validate() (valid []tickets.Ticket, invalid []InvalidParam, rejectedTickets int) {
+	if r.Tickets == nil {
+		invalid = append(invalid, InvalidParam{Name: "tickets", Reason: "is required"})
+	}
+
+	for i, ticketStatus := range r.Tickets {
+		ticket, ticketInvalid := validateTicket(fmt.Sprintf("tickets[%d]", i), ticketStatus)
+		if len(ticketInvalid) > 0 {
+			rejectedTickets++
+			invalid = append(invalid, ticketInvalid...)
+			continue
+		}
+		valid = append(valid, ticket)
+	}
+
+	return valid, invalid, rejectedTickets
+}
+
+func validateTicket(name string, ticketStatus TicketStatus) (tickets.Ticket, []InvalidParam) {
+	ticket := tickets.Ticket{
+		TicketId:      ticketStatus.TicketId,
+		Status:        ticketStatus.Status,
+		CustomerEmail: ticketStatus.CustomerEmail,
+	}
+	ticket.Price.Currency = ticketStatus.Price.Currency
+
+	var invalid []InvalidParam
+	add := func(field string, reason string) {
+		invalid = append(invalid, InvalidParam{Name: name + "." + field, Reason: reason})
+	}
+
+	if ticket.TicketId == "" {
+		add("ticket_id", "is required")
+	}
+
+	if ticket.CustomerEmail == "" {
+		add("customer_email", "is required")
+	} else if addr, err := mail.ParseAddress(ticket.CustomerEmail); err != nil || addr.Address != ticket.CustomerEmail {
+		add("customer_email", "must be a valid email address")
+	}
+
+	if !ticket.Status.Valid() {
+		add("status", fmt.Sprintf("must be one of %q, %q", tickets.StatusConfirmed, tickets.StatusCanceled))
+	}
+
+	if len(ticketStatus.Price.Amount) == 0 || string(ticketStatus.Price.Amount) == "null" {
+		add("price.amount", "is required")
+	} else if err := ticket.Price.Amount.UnmarshalJSON(ticketStatus.Price.Amount); err != nil {
+		add("price.amount", "must be a decimal number")
+	} else if !ticket.Price.IsPositive() {
+		add("price.amount", "must be positive")
+	}
+
+	if !ticket.Price.Currency.Valid() {
+		add("price.currency", "must be an ISO 4217 currency code")
+	}
+
+	return ticket, invalid
+}
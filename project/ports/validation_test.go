@@ -0,0 +1,116 @@
+package ports_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"tickets/money"
+	"tickets/ports"
+	"tickets/tickets"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTicketsStatus_validation(t *testing.T) {
+	testCases := []struct {
+		name              string
+		body              string
+		wantStatus        int
+		wantTitle         string
+		wantInvalidParams []ports.InvalidParam
+	}{
+		{
+			name:       "malformed_body",
+			body:       `{"tickets":[`,
+			wantStatus: http.StatusBadRequest,
+			wantTitle:  "Malformed request body",
+		},
+		{
+			name:       "missing_tickets",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+			wantTitle:  "Invalid tickets status request",
+			wantInvalidParams: []ports.InvalidParam{
+				{Name: "tickets", Reason: "is required"},
+			},
+		},
+		{
+			name:       "missing_fields",
+			body:       `{"tickets":[{}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantTitle:  "Invalid tickets status request",
+			wantInvalidParams: []ports.InvalidParam{
+				{Name: "tickets[0].ticket_id", Reason: "is required"},
+				{Name: "tickets[0].customer_email", Reason: "is required"},
+				{Name: "tickets[0].status", Reason: `must be one of "confirmed", "canceled"`},
+				{Name: "tickets[0].price.amount", Reason: "is required"},
+				{Name: "tickets[0].price.currency", Reason: "must be an ISO 4217 currency code"},
+			},
+		},
+		{
+			name: "invalid_fields",
+			body: `{"tickets":[
+				{"ticket_id":"1","status":"refunded","customer_email":"not an email","price":{"amount":"49,90","currency":"XXY"}},
+				{"ticket_id":"2","status":"confirmed","customer_email":"user@example.com","price":{"amount":"-1","currency":"EUR"}}
+			]}`,
+			wantStatus: http.StatusBadRequest,
+			wantTitle:  "Invalid tickets status request",
+			wantInvalidParams: []ports.InvalidParam{
+				{Name: "tickets[0].customer_email", Reason: "must be a valid email address"},
+				{Name: "tickets[0].status", Reason: `must be one of "confirmed", "canceled"`},
+				{Name: "tickets[0].price.amount", Reason: "must be a decimal number"},
+				{Name: "tickets[0].price.currency", Reason: "must be an ISO 4217 currency code"},
+				{Name: "tickets[1].price.amount", Reason: "must be positive"},
+			},
+		},
+		{
+			name: "one_invalid_ticket_rejects_the_request",
+			body: `{"tickets":[
+				` + ticketJSON("1") + `,
+				{"ticket_id":"2","status":"confirmed","customer_email":"user@example.com","price":{"amount":true,"currency":"EUR"}}
+			]}`,
+			wantStatus: http.StatusBadRequest,
+			wantTitle:  "Invalid tickets status request",
+			wantInvalidParams: []ports.InvalidParam{
+				{Name: "tickets[1].price.amount", Reason: "must be a decimal number"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender := &senderStub{}
+
+			rec := postTicketsStatus(t, sender, tc.body)
+			assert.Equal(t, tc.wantStatus, rec.Code)
+			assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+			assert.Empty(t, sender.sent)
+
+			problem := ports.Problem{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+			assert.Equal(t, tc.wantTitle, problem.Title)
+			assert.Equal(t, tc.wantInvalidParams, problem.InvalidParams)
+		})
+	}
+}
+
+func TestTicketsStatus_valid_request(t *testing.T) {
+	sender := &senderStub{}
+
+	rec := postTicketsStatus(t, sender, `{"tickets":[
+		{"ticket_id":"1","status":"confirmed","customer_email":"user@example.com","price":{"amount":"49.90","currency":"EUR"}},
+		{"ticket_id":"2","status":"canceled","customer_email":"user@example.com","price":{"amount":12.5,"currency":"USD"}}
+	]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	require.Len(t, sender.sent, 2)
+	assert.Equal(t, tickets.Ticket{
+		TicketId:      "1",
+		Status:        tickets.StatusConfirmed,
+		CustomerEmail: "user@example.com",
+		Price:         money.Money{Amount: money.MustParseDecimal("49.90"), Currency: "EUR"},
+	}, sender.sent[0].Ticket)
+	assert.Equal(t, money.MustParseDecimal("12.5"), sender.sent[1].Ticket.Price.Amount)
+	assert.Equal(t, money.Currency("USD"), sender.sent[1].Ticket.Price.Currency)
+}
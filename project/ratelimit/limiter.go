@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type Limit struct {
+	// PerSecond is the rate at which tokens are added to the bucket.
+	PerSecond float64
+	// Burst is the size of the bucket.
+	Burst int
+}
+
+// Limiter keeps a token bucket per key. It is safe to share between goroutines.
+type Limiter struct {
+	buckets map[string]*rate.Limiter
+	observe func(key string, wait time.Duration)
+}
+
+// New creates a limiter with a bucket for each key in limits. Keys without
+// a limit are not limited. observe, if not nil, is called with the time
+// every Wait spent blocked.
+func New(limits map[string]Limit, observe func(key string, wait time.Duration)) *Limiter {
+	buckets := make(map[string]*rate.Limiter, len(limits))
+	for key, limit := range limits {
+		buckets[key] = rate.NewLimiter(rate.Limit(limit.PerSecond), limit.Burst)
+	}
+
+	return &Limiter{
+		buckets: buckets,
+		observe: observe,
+	}
+}
+
+// Wait blocks until a token for key is available. It fails right away if
+// ctx would be done before that.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	if l == nil {
+		return nil
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		return nil
+	}
+
+	start := time.Now()
+	err := bucket.Wait(ctx)
+	if l.observe != nil {
+		l.observe(key, time.Since(start))
+	}
+	if err != nil {
+		return fmt.Errorf("rate limit of %s: %w", key, err)
+	}
+
+	return nil
+}
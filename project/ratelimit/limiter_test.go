@@ -0,0 +1,60 @@
+package ratelimit_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"tickets/ratelimit"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	var mu sync.Mutex
+	waits := map[string]int{}
+
+	limiter := ratelimit.New(map[string]ratelimit.Limit{
+		"tickets-to-print": {PerSecond: 10, Burst: 1},
+	}, func(key string, wait time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		waits[key]++
+	})
+
+	ctx := context.Background()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, limiter.Wait(ctx, "tickets-to-print"))
+		}()
+	}
+	wg.Wait()
+
+	// The bucket is shared: the first call takes the burst, the others wait 100ms each.
+	assert.GreaterOrEqual(t, time.Since(start), time.Millisecond*150)
+	assert.Equal(t, map[string]int{"tickets-to-print": 3}, waits)
+
+	// Sheets without a limit don't wait.
+	require.NoError(t, limiter.Wait(ctx, "tickets-to-refund"))
+}
+
+func TestLimiter_respects_deadline(t *testing.T) {
+	limiter := ratelimit.New(map[string]ratelimit.Limit{
+		"tickets-to-print": {PerSecond: 0.1, Burst: 1},
+	}, nil)
+
+	require.NoError(t, limiter.Wait(context.Background(), "tickets-to-print"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	start := time.Now()
+	assert.Error(t, limiter.Wait(ctx, "tickets-to-print"))
+	assert.Less(t, time.Since(start), time.Millisecond*50)
+}
@@ -0,0 +1,65 @@
+package readmodel
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryRepository keeps tickets in memory. The read model is rebuilt from
+// the event streams after a restart.
+type MemoryRepository struct {
+	mu      sync.RWMutex
+	tickets map[string]Ticket
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		tickets: make(map[string]Ticket),
+	}
+}
+
+func (r *MemoryRepository) Update(ctx context.Context, ticketID string, update func(ticket Ticket, found bool) (Ticket, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ticket, found := r.tickets[ticketID]
+
+	updated, err := update(ticket, found)
+	if err != nil {
+		return err
+	}
+
+	r.tickets[ticketID] = updated
+	return nil
+}
+
+func (r *MemoryRepository) Get(ctx context.Context, ticketID string) (Ticket, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ticket, ok := r.tickets[ticketID]
+	if !ok {
+		return Ticket{}, ErrNotFound
+	}
+
+	return ticket, nil
+}
+
+func (r *MemoryRepository) List(ctx context.Context, filter Filter) ([]Ticket, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tickets := make([]Ticket, 0)
+	for _, ticket := range r.tickets {
+		if filter.Match(ticket) {
+			tickets = append(tickets, ticket)
+		}
+	}
+
+	sortByBookedAt(tickets)
+	if filter.Limit > 0 && len(tickets) > filter.Limit {
+		tickets = tickets[:filter.Limit]
+	}
+
+	return tickets, nil
+}
@@ -0,0 +1,146 @@
+package readmodel
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"tickets/events"
+	"tickets/retry"
+	"tickets/tickets"
+	"time"
+)
+
+// Projection keeps the ticket read model up to date with booking events.
+//
+// Events move a ticket along its lifecycle. Events may be delivered more
+// than once and in any order: an event received before the one it follows
+// is parked and applied once its predecessor arrives, and an illegal
+// transition is rejected. That also lets the read model be rebuilt while
+// new events are still being projected.
+type Projection struct {
+	repo Repository
+}
+
+func NewProjection(repo Repository) *Projection {
+	return &Projection{
+		repo: repo,
+	}
+}
+
+func (p *Projection) OnBookingConfirmed(ctx context.Context, event *events.TicketBookingConfirmed) error {
+	_, err := p.ApplyBookingConfirmed(ctx, event)
+	return err
+}
+
+func (p *Projection) OnBookingCanceled(ctx context.Context, event *events.TicketBookingCanceled) error {
+	_, err := p.ApplyBookingCanceled(ctx, event)
+	return err
+}
+
+// ApplyBookingConfirmed projects the event like OnBookingConfirmed, and
+// returns the ticket it was projected to.
+func (p *Projection) ApplyBookingConfirmed(ctx context.Context, event *events.TicketBookingConfirmed) (Ticket, error) {
+	return p.apply(ctx, event.TicketId, event.Header, TicketEvent{
+		Status:        tickets.StatusConfirmed,
+		CustomerEmail: event.CustomerEmail,
+		Price:         event.Price,
+	})
+}
+
+// ApplyBookingCanceled projects the event like OnBookingCanceled, and
+// returns the ticket it was projected to.
+func (p *Projection) ApplyBookingCanceled(ctx context.Context, event *events.TicketBookingCanceled) (Ticket, error) {
+	return p.apply(ctx, event.TicketId, event.Header, TicketEvent{
+		Status:        tickets.StatusCanceled,
+		CustomerEmail: event.CustomerEmail,
+		Price:         event.Price,
+	})
+}
+
+func (p *Projection) apply(ctx context.Context, ticketID string, header events.Header, event TicketEvent) (Ticket, error) {
+	publishedAt, err := time.Parse(time.RFC3339Nano, header.PublishedAt)
+	if err != nil {
+		return Ticket{}, retry.Permanent(fmt.Errorf("invalid published_at of event %s: %w", header.Id, err))
+	}
+
+	event.EventId = header.Id
+	event.PublishedAt = publishedAt
+
+	var projected Ticket
+	err = p.repo.Update(ctx, ticketID, func(ticket Ticket, found bool) (Ticket, error) {
+		if !found {
+			ticket = Ticket{
+				TicketId: ticketID,
+				BookedAt: publishedAt,
+			}
+		}
+
+		if _, received := ticket.Outcome(event.EventId); received {
+			projected = ticket
+			return ticket, nil
+		}
+		if publishedAt.Before(ticket.BookedAt) {
+			ticket.BookedAt = publishedAt
+		}
+
+		// Copy, so the ticket passed in stays unchanged if the update fails.
+		ticket.Events = append(append([]TicketEvent(nil), ticket.Events...), event)
+		ticket.transition(len(ticket.Events) - 1)
+		ticket.reconcile(event.EventId)
+
+		projected = ticket
+		return ticket, nil
+	})
+	if err != nil {
+		return Ticket{}, err
+	}
+
+	return projected, nil
+}
+
+// transition applies, parks or rejects the i-th event of the ticket.
+func (t *Ticket) transition(i int) {
+	event := &t.Events[i]
+
+	switch {
+	case tickets.CanTransition(t.Status, event.Status):
+		t.Status = event.Status
+		t.CustomerEmail = event.CustomerEmail
+		t.Price = event.Price
+		t.UpdatedAt = event.PublishedAt
+		event.Outcome = OutcomeApplied
+	case tickets.Ahead(t.Status, event.Status):
+		event.Outcome = OutcomeParked
+	default:
+		event.Outcome = OutcomeRejected
+	}
+}
+
+// reconcile retries parked events, oldest first, until none can be applied.
+// The events applied are marked as applied after the event which arrived.
+func (t *Ticket) reconcile(arrivedID string) {
+	for {
+		var parked []int
+		for i, event := range t.Events {
+			if event.Outcome == OutcomeParked {
+				parked = append(parked, i)
+			}
+		}
+		sort.SliceStable(parked, func(a, b int) bool {
+			return t.Events[parked[a]].PublishedAt.Before(t.Events[parked[b]].PublishedAt)
+		})
+
+		progressed := false
+		for _, i := range parked {
+			t.transition(i)
+			if t.Events[i].Outcome == OutcomeApplied {
+				t.Events[i].AppliedAfter = arrivedID
+				progressed = true
+				break
+			}
+		}
+		if !progressed {
+			return
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package readmodel_test
+
+import (
+	"context"
+	"testing"
+	"tickets/events"
+	"tickets/money"
+	"tickets/readmodel"
+	"tickets/tickets"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func header[T events.Event](publishedAt time.Time) events.Header {
+	h := events.NewHeader[T]()
+	h.PublishedAt = publishedAt.Format(time.RFC3339Nano)
+	return h
+}
+
+func TestProjection(t *testing.T) {
+	price, err := money.New("49.90", "EUR")
+	require.NoError(t, err)
+
+	bookedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	confirmed := &events.TicketBookingConfirmed{
+		Header:        header[events.TicketBookingConfirmed](bookedAt),
+		TicketId:      "ticket-1",
+		CustomerEmail: "alice@example.com",
+		Price:         price,
+	}
+	canceled := &events.TicketBookingCanceled{
+		Header:        header[events.TicketBookingCanceled](bookedAt.Add(time.Minute)),
+		TicketId:      "ticket-1",
+		CustomerEmail: "alice@example.com",
+		Price:         price,
+	}
+	confirmedAgain := &events.TicketBookingConfirmed{
+		Header:        header[events.TicketBookingConfirmed](bookedAt.Add(time.Hour)),
+		TicketId:      "ticket-1",
+		CustomerEmail: "alice@example.com",
+		Price:         price,
+	}
+
+	onConfirmed := func(event *events.TicketBookingConfirmed) func(ctx context.Context, p *readmodel.Projection) error {
+		return func(ctx context.Context, p *readmodel.Projection) error {
+			return p.OnBookingConfirmed(ctx, event)
+		}
+	}
+	onCanceled := func(event *events.TicketBookingCanceled) func(ctx context.Context, p *readmodel.Projection) error {
+		return func(ctx context.Context, p *readmodel.Projection) error {
+			return p.OnBookingCanceled(ctx, event)
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		apply            []func(ctx context.Context, p *readmodel.Projection) error
+		expectedStatus   tickets.Status
+		expectedOutcomes map[string]readmodel.Outcome
+	}{
+		{
+			name:           "in_order",
+			apply:          []func(ctx context.Context, p *readmodel.Projection) error{onConfirmed(confirmed), onCanceled(canceled)},
+			expectedStatus: tickets.StatusCanceled,
+			expectedOutcomes: map[string]readmodel.Outcome{
+				confirmed.Header.Id: readmodel.OutcomeApplied,
+				canceled.Header.Id:  readmodel.OutcomeApplied,
+			},
+		},
+		{
+			name:           "cancel_parked_until_confirmed",
+			apply:          []func(ctx context.Context, p *readmodel.Projection) error{onCanceled(canceled), onConfirmed(confirmed)},
+			expectedStatus: tickets.StatusCanceled,
+			expectedOutcomes: map[string]readmodel.Outcome{
+				confirmed.Header.Id: readmodel.OutcomeApplied,
+				canceled.Header.Id:  readmodel.OutcomeApplied,
+			},
+		},
+		{
+			name:           "cancel_without_confirm",
+			apply:          []func(ctx context.Context, p *readmodel.Projection) error{onCanceled(canceled)},
+			expectedStatus: "",
+			expectedOutcomes: map[string]readmodel.Outcome{
+				canceled.Header.Id: readmodel.OutcomeParked,
+			},
+		},
+		{
+			name:           "confirm_after_cancel_rejected",
+			apply:          []func(ctx context.Context, p *readmodel.Projection) error{onConfirmed(confirmed), onCanceled(canceled), onConfirmed(confirmedAgain)},
+			expectedStatus: tickets.StatusCanceled,
+			expectedOutcomes: map[string]readmodel.Outcome{
+				confirmed.Header.Id:      readmodel.OutcomeApplied,
+				canceled.Header.Id:       readmodel.OutcomeApplied,
+				confirmedAgain.Header.Id: readmodel.OutcomeRejected,
+			},
+		},
+		{
+			name:           "redelivered",
+			apply:          []func(ctx context.Context, p *readmodel.Projection) error{onConfirmed(confirmed), onCanceled(canceled), onConfirmed(confirmed)},
+			expectedStatus: tickets.StatusCanceled,
+			expectedOutcomes: map[string]readmodel.Outcome{
+				confirmed.Header.Id: readmodel.OutcomeApplied,
+				canceled.Header.Id:  readmodel.OutcomeApplied,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := readmodel.NewMemoryRepository()
+			projection := readmodel.NewProjection(repo)
+
+			for _, apply := range tc.apply {
+				require.NoError(t, apply(ctx, projection))
+			}
+
+			ticket, err := repo.Get(ctx, "ticket-1")
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expectedStatus, ticket.Status)
+
+			outcomes := map[string]readmodel.Outcome{}
+			firstPublishedAt := ticket.Events[0].PublishedAt
+			for _, event := range ticket.Events {
+				outcomes[event.EventId] = event.Outcome
+				if event.PublishedAt.Before(firstPublishedAt) {
+					firstPublishedAt = event.PublishedAt
+				}
+			}
+			assert.Equal(t, firstPublishedAt, ticket.BookedAt)
+			assert.Equal(t, tc.expectedOutcomes, outcomes)
+		})
+	}
+}
+
+func TestTicket_AppliedBy(t *testing.T) {
+	ctx := context.Background()
+	repo := readmodel.NewMemoryRepository()
+	projection := readmodel.NewProjection(repo)
+
+	bookedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	confirmed := &events.TicketBookingConfirmed{Header: header[events.TicketBookingConfirmed](bookedAt), TicketId: "ticket-1"}
+	canceled := &events.TicketBookingCanceled{Header: header[events.TicketBookingCanceled](bookedAt.Add(time.Minute)), TicketId: "ticket-1"}
+
+	ticket, err := projection.ApplyBookingCanceled(ctx, canceled)
+	require.NoError(t, err)
+	assert.Empty(t, ticket.AppliedBy(canceled.Header.Id), "parked")
+
+	ticket, err = projection.ApplyBookingConfirmed(ctx, confirmed)
+	require.NoError(t, err)
+
+	applied := func(eventID string) []tickets.Status {
+		var statuses []tickets.Status
+		for _, event := range ticket.AppliedBy(eventID) {
+			statuses = append(statuses, event.Status)
+		}
+		return statuses
+	}
+	assert.Equal(t, []tickets.Status{tickets.StatusConfirmed, tickets.StatusCanceled}, applied(confirmed.Header.Id))
+	assert.Empty(t, applied(canceled.Header.Id))
+
+	// Redelivered, the event applies the same events.
+	ticket, err = projection.ApplyBookingConfirmed(ctx, confirmed)
+	require.NoError(t, err)
+	assert.Equal(t, []tickets.Status{tickets.StatusConfirmed, tickets.StatusCanceled}, applied(confirmed.Header.Id))
+}
@@ -0,0 +1,216 @@
+package readmodel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"tickets/tickets"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisBatchSize     = 100
+	redisUpdateRetries = 10
+)
+
+// RedisRepository keeps tickets in Redis, so all instances of the service
+// share the read model. Each ticket is stored as JSON under its own key.
+// Indexes sorted by BookedAt list all tickets, the tickets of a customer and
+// the tickets of a status. Tickets projected before the customer and status
+// indexes existed are added to them by rebuilding the read model.
+type RedisRepository struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+func NewRedisRepository(rdb redis.UniversalClient, prefix string) *RedisRepository {
+	return &RedisRepository{
+		rdb:    rdb,
+		prefix: prefix,
+	}
+}
+
+func (r *RedisRepository) ticketKey(ticketID string) string {
+	return r.prefix + ":ticket:" + ticketID
+}
+
+func (r *RedisRepository) indexKey() string {
+	return r.prefix + ":tickets"
+}
+
+func (r *RedisRepository) emailIndexKey(email string) string {
+	return r.prefix + ":tickets:email:" + email
+}
+
+func (r *RedisRepository) statusIndexKey(status tickets.Status) string {
+	return r.prefix + ":tickets:status:" + string(status)
+}
+
+// indexKeys returns the keys of the indexes listing ticket.
+func (r *RedisRepository) indexKeys(ticket Ticket) []string {
+	keys := []string{r.indexKey()}
+	if ticket.CustomerEmail != "" {
+		keys = append(keys, r.emailIndexKey(ticket.CustomerEmail))
+	}
+	if ticket.Status != "" {
+		keys = append(keys, r.statusIndexKey(ticket.Status))
+	}
+	return keys
+}
+
+// listIndexKey returns the key of the narrowest index listing all tickets
+// matching filter.
+func (r *RedisRepository) listIndexKey(filter Filter) string {
+	switch {
+	case filter.CustomerEmail != "":
+		return r.emailIndexKey(filter.CustomerEmail)
+	case filter.Status != "":
+		return r.statusIndexKey(filter.Status)
+	default:
+		return r.indexKey()
+	}
+}
+
+// Update applies update with optimistic locking: it's called again with the
+// current ticket if the ticket was changed meanwhile.
+func (r *RedisRepository) Update(ctx context.Context, ticketID string, update func(ticket Ticket, found bool) (Ticket, error)) error {
+	key := r.ticketKey(ticketID)
+
+	for i := 0; i < redisUpdateRetries; i++ {
+		err := r.rdb.Watch(ctx, func(tx *redis.Tx) error {
+			ticket, err := r.get(ctx, tx, ticketID)
+			found := err == nil
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+
+			updated, err := update(ticket, found)
+			if err != nil {
+				return err
+			}
+
+			payload, err := json.Marshal(updated)
+			if err != nil {
+				return fmt.Errorf("cannot marshal ticket %s: %w", ticketID, err)
+			}
+
+			indexKeys := r.indexKeys(updated)
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, payload, 0)
+				for _, indexKey := range indexKeys {
+					pipe.ZAdd(ctx, indexKey, redis.Z{
+						Score:  float64(updated.BookedAt.UnixMilli()),
+						Member: ticketID,
+					})
+				}
+				if found {
+					// The email or status of the ticket changed.
+					for _, indexKey := range r.indexKeys(ticket) {
+						if !slices.Contains(indexKeys, indexKey) {
+							pipe.ZRem(ctx, indexKey, ticketID)
+						}
+					}
+				}
+				return nil
+			})
+			return err
+		}, key)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+
+		return err
+	}
+
+	return fmt.Errorf("cannot update ticket %s: changed concurrently too many times", ticketID)
+}
+
+func (r *RedisRepository) Get(ctx context.Context, ticketID string) (Ticket, error) {
+	return r.get(ctx, r.rdb, ticketID)
+}
+
+func (r *RedisRepository) get(ctx context.Context, rdb redis.Cmdable, ticketID string) (Ticket, error) {
+	payload, err := rdb.Get(ctx, r.ticketKey(ticketID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Ticket{}, ErrNotFound
+	}
+	if err != nil {
+		return Ticket{}, fmt.Errorf("cannot get ticket %s: %w", ticketID, err)
+	}
+
+	ticket := Ticket{}
+	err = json.Unmarshal(payload, &ticket)
+	if err != nil {
+		return Ticket{}, fmt.Errorf("cannot unmarshal ticket %s: %w", ticketID, err)
+	}
+
+	return ticket, nil
+}
+
+// List reads the narrowest index matching filter in batches, and stops once
+// filter.Limit tickets were found.
+func (r *RedisRepository) List(ctx context.Context, filter Filter) ([]Ticket, error) {
+	// The index narrows the booking dates to whole milliseconds, Match filters the rest.
+	byScore := &redis.ZRangeBy{Min: "-inf", Max: "+inf", Count: redisBatchSize}
+	if !filter.BookedFrom.IsZero() {
+		byScore.Min = strconv.FormatInt(filter.BookedFrom.UnixMilli(), 10)
+	}
+	if !filter.BookedTo.IsZero() {
+		byScore.Max = strconv.FormatInt(filter.BookedTo.UnixMilli(), 10)
+	}
+
+	list := make([]Ticket, 0)
+	for {
+		ids, err := r.rdb.ZRangeByScore(ctx, r.listIndexKey(filter), byScore).Result()
+		if err != nil {
+			return nil, fmt.Errorf("cannot list tickets: %w", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		keys := make([]string, 0, len(ids))
+		for _, id := range ids {
+			keys = append(keys, r.ticketKey(id))
+		}
+
+		payloads, err := r.rdb.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get tickets: %w", err)
+		}
+
+		for i, payload := range payloads {
+			s, ok := payload.(string)
+			if !ok {
+				// Deleted since the index was read.
+				continue
+			}
+
+			ticket := Ticket{}
+			err := json.Unmarshal([]byte(s), &ticket)
+			if err != nil {
+				return nil, fmt.Errorf("cannot unmarshal %s: %w", keys[i], err)
+			}
+
+			if filter.Match(ticket) {
+				list = append(list, ticket)
+			}
+		}
+
+		if filter.Limit > 0 && len(list) >= filter.Limit {
+			break
+		}
+		byScore.Offset += int64(len(ids))
+	}
+
+	sortByBookedAt(list)
+	if filter.Limit > 0 && len(list) > filter.Limit {
+		list = list[:filter.Limit]
+	}
+
+	return list, nil
+}
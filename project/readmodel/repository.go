@@ -0,0 +1,134 @@
+package readmodel
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"tickets/money"
+	"tickets/tickets"
+	"time"
+)
+
+var ErrNotFound = errors.New("ticket not found")
+
+type Outcome string
+
+const (
+	// OutcomeApplied events moved the ticket along its lifecycle.
+	OutcomeApplied Outcome = "applied"
+	// OutcomeParked events arrived before the events they follow, they
+	// are applied once those arrive.
+	OutcomeParked Outcome = "parked"
+	// OutcomeRejected events are illegal transitions, like a confirmation
+	// of a canceled ticket.
+	OutcomeRejected Outcome = "rejected"
+)
+
+type TicketEvent struct {
+	EventId       string         `json:"event_id"`
+	Status        tickets.Status `json:"status"`
+	CustomerEmail string         `json:"customer_email"`
+	Price         money.Money    `json:"price"`
+	PublishedAt   time.Time      `json:"published_at"`
+	Outcome       Outcome        `json:"outcome"`
+	// AppliedAfter is the ID of the event whose arrival applied this
+	// event, if it was parked.
+	AppliedAfter string `json:"applied_after,omitempty"`
+}
+
+type Ticket struct {
+	TicketId string `json:"ticket_id"`
+	// Status is empty while all events of the ticket are parked.
+	Status        tickets.Status `json:"status"`
+	CustomerEmail string         `json:"customer_email"`
+	Price         money.Money    `json:"price"`
+	// BookedAt is when the first event of the ticket was published.
+	BookedAt time.Time `json:"booked_at"`
+	// UpdatedAt is when the event which set the current status was published.
+	UpdatedAt time.Time `json:"updated_at"`
+	// Events are all events of the ticket, in the order they were received.
+	Events []TicketEvent `json:"events"`
+}
+
+// Outcome returns what happened to the event, or false if it wasn't received.
+func (t Ticket) Outcome(eventID string) (Outcome, bool) {
+	for _, event := range t.Events {
+		if event.EventId == eventID {
+			return event.Outcome, true
+		}
+	}
+
+	return "", false
+}
+
+// AppliedBy returns the events the arrival of the event applied, in the
+// order they were applied: the event itself, unless it was parked, and the
+// parked events it let through.
+func (t Ticket) AppliedBy(eventID string) []TicketEvent {
+	var applied []TicketEvent
+	for _, event := range t.Events {
+		if event.EventId == eventID && event.Outcome == OutcomeApplied && event.AppliedAfter == "" {
+			applied = append(applied, event)
+		}
+	}
+
+	var reconciled []TicketEvent
+	for _, event := range t.Events {
+		if event.AppliedAfter == eventID {
+			reconciled = append(reconciled, event)
+		}
+	}
+	sort.SliceStable(reconciled, func(i, j int) bool {
+		return reconciled[i].PublishedAt.Before(reconciled[j].PublishedAt)
+	})
+
+	return append(applied, reconciled...)
+}
+
+// Filter selects tickets, zero fields match every ticket.
+type Filter struct {
+	Status        tickets.Status
+	CustomerEmail string
+	// BookedFrom and BookedTo limit BookedAt to [BookedFrom, BookedTo).
+	BookedFrom time.Time
+	BookedTo   time.Time
+	// Limit is the maximum number of tickets listed, zero lists all of them.
+	Limit int
+}
+
+func (f Filter) Match(t Ticket) bool {
+	if f.Status != "" && t.Status != f.Status {
+		return false
+	}
+	if f.CustomerEmail != "" && t.CustomerEmail != f.CustomerEmail {
+		return false
+	}
+	if !f.BookedFrom.IsZero() && t.BookedAt.Before(f.BookedFrom) {
+		return false
+	}
+	if !f.BookedTo.IsZero() && !t.BookedAt.Before(f.BookedTo) {
+		return false
+	}
+
+	return true
+}
+
+// sortByBookedAt sorts tickets by BookedAt, then by ID.
+func sortByBookedAt(tickets []Ticket) {
+	sort.Slice(tickets, func(i, j int) bool {
+		if !tickets[i].BookedAt.Equal(tickets[j].BookedAt) {
+			return tickets[i].BookedAt.Before(tickets[j].BookedAt)
+		}
+		return tickets[i].TicketId < tickets[j].TicketId
+	})
+}
+
+type Repository interface {
+	// Update applies update to the ticket atomically. The ticket passed to
+	// update is the zero value with found false if it doesn't exist yet.
+	Update(ctx context.Context, ticketID string, update func(ticket Ticket, found bool) (Ticket, error)) error
+	Get(ctx context.Context, ticketID string) (Ticket, error)
+	// List returns tickets matching filter ordered by BookedAt, the first
+	// filter.Limit of them if it's set.
+	List(ctx context.Context, filter Filter) ([]Ticket, error)
+}
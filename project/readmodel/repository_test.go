@@ -0,0 +1,164 @@
+package readmodel_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"tickets/readmodel"
+	"tickets/tickets"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func repositories(t *testing.T) map[string]func() readmodel.Repository {
+	return map[string]func() readmodel.Repository{
+		"memory": func() readmodel.Repository {
+			return readmodel.NewMemoryRepository()
+		},
+		"redis": func() readmodel.Repository {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { _ = rdb.Close() })
+
+			return readmodel.NewRedisRepository(rdb, "read-model")
+		},
+	}
+}
+
+func TestRepository_List(t *testing.T) {
+	for name, newRepo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := newRepo()
+
+			day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+			for _, ticket := range []readmodel.Ticket{
+				{TicketId: "1", Status: tickets.StatusConfirmed, CustomerEmail: "alice@example.com", BookedAt: day.Add(time.Hour)},
+				{TicketId: "2", Status: tickets.StatusCanceled, CustomerEmail: "alice@example.com", BookedAt: day.Add(time.Hour * 2)},
+				{TicketId: "3", Status: tickets.StatusConfirmed, CustomerEmail: "bob@example.com", BookedAt: day.AddDate(0, 0, 1)},
+			} {
+				ticket := ticket
+				require.NoError(t, repo.Update(ctx, ticket.TicketId, func(readmodel.Ticket, bool) (readmodel.Ticket, error) {
+					return ticket, nil
+				}))
+			}
+
+			ids := func(filter readmodel.Filter) []string {
+				list, err := repo.List(ctx, filter)
+				require.NoError(t, err)
+
+				ids := make([]string, 0, len(list))
+				for _, ticket := range list {
+					ids = append(ids, ticket.TicketId)
+				}
+				return ids
+			}
+
+			assert.Equal(t, []string{"1", "2", "3"}, ids(readmodel.Filter{}))
+			assert.Equal(t, []string{"1", "3"}, ids(readmodel.Filter{Status: tickets.StatusConfirmed}))
+			assert.Equal(t, []string{"1", "2"}, ids(readmodel.Filter{CustomerEmail: "alice@example.com"}))
+			assert.Equal(t, []string{"1", "2"}, ids(readmodel.Filter{BookedFrom: day, BookedTo: day.AddDate(0, 0, 1)}))
+			assert.Equal(t, []string{"1"}, ids(readmodel.Filter{Status: tickets.StatusConfirmed, BookedTo: day.AddDate(0, 0, 1)}))
+			assert.Equal(t, []string{"1", "2"}, ids(readmodel.Filter{Limit: 2}))
+			assert.Equal(t, []string{"3"}, ids(readmodel.Filter{Status: tickets.StatusConfirmed, BookedFrom: day.Add(time.Hour * 2), Limit: 1}))
+
+			require.NoError(t, repo.Update(ctx, "1", func(ticket readmodel.Ticket, _ bool) (readmodel.Ticket, error) {
+				ticket.Status = tickets.StatusCanceled
+				ticket.CustomerEmail = "carol@example.com"
+				return ticket, nil
+			}))
+			assert.Equal(t, []string{"3"}, ids(readmodel.Filter{Status: tickets.StatusConfirmed}))
+			assert.Equal(t, []string{"1", "2"}, ids(readmodel.Filter{Status: tickets.StatusCanceled}))
+			assert.Equal(t, []string{"2"}, ids(readmodel.Filter{CustomerEmail: "alice@example.com"}))
+			assert.Equal(t, []string{"1"}, ids(readmodel.Filter{CustomerEmail: "carol@example.com"}))
+		})
+	}
+}
+
+func TestRepository_List_limit(t *testing.T) {
+	for name, newRepo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := newRepo()
+
+			start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+			for i := 0; i < 300; i++ {
+				ticket := readmodel.Ticket{
+					TicketId:      fmt.Sprintf("%03d", i),
+					Status:        tickets.StatusConfirmed,
+					CustomerEmail: "alice@example.com",
+					BookedAt:      start.Add(time.Minute * time.Duration(i)),
+				}
+				if i%2 == 1 {
+					ticket.Status = tickets.StatusCanceled
+				}
+				require.NoError(t, repo.Update(ctx, ticket.TicketId, func(readmodel.Ticket, bool) (readmodel.Ticket, error) {
+					return ticket, nil
+				}))
+			}
+
+			list, err := repo.List(ctx, readmodel.Filter{CustomerEmail: "alice@example.com", Status: tickets.StatusCanceled, Limit: 120})
+			require.NoError(t, err)
+			require.Len(t, list, 120)
+			assert.Equal(t, "001", list[0].TicketId)
+			assert.Equal(t, "239", list[119].TicketId)
+
+			list, err = repo.List(ctx, readmodel.Filter{})
+			require.NoError(t, err)
+			assert.Len(t, list, 300)
+		})
+	}
+}
+
+func TestRepository_Update(t *testing.T) {
+	for name, newRepo := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := newRepo()
+
+			_, err := repo.Get(ctx, "1")
+			assert.ErrorIs(t, err, readmodel.ErrNotFound)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					err := repo.Update(ctx, "1", func(ticket readmodel.Ticket, found bool) (readmodel.Ticket, error) {
+						ticket.TicketId = "1"
+						ticket.Events = append(ticket.Events, readmodel.TicketEvent{EventId: fmt.Sprint(i)})
+						return ticket, nil
+					})
+					assert.NoError(t, err)
+				}(i)
+			}
+			wg.Wait()
+
+			ticket, err := repo.Get(ctx, "1")
+			require.NoError(t, err)
+
+			ids := make([]string, 0, len(ticket.Events))
+			for _, event := range ticket.Events {
+				ids = append(ids, event.EventId)
+			}
+			assert.ElementsMatch(t, []string{"0", "1", "2", "3", "4"}, ids, "no update should be lost")
+
+			errUpdate := fmt.Errorf("update failed")
+			err = repo.Update(ctx, "1", func(ticket readmodel.Ticket, found bool) (readmodel.Ticket, error) {
+				assert.True(t, found)
+				return readmodel.Ticket{}, errUpdate
+			})
+			assert.ErrorIs(t, err, errUpdate)
+
+			unchanged, err := repo.Get(ctx, "1")
+			require.NoError(t, err)
+			assert.Equal(t, ticket, unchanged)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package receipts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrNotFound = errors.New("receipt not found")
+
+// Store keeps the number of the receipt issued for each ticket, so the
+// receipt can be voided when the booking is canceled. Receipts are kept
+// for ttl after they were issued, each under its own key. The time the
+// first receipt was saved is kept too, receipts of tickets confirmed before
+// weren't tracked.
+type Store struct {
+	rdb    redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func NewStore(rdb redis.UniversalClient, prefix string, ttl time.Duration) *Store {
+	return &Store{
+		rdb:    rdb,
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+func (s *Store) key(ticketID string) string {
+	return s.prefix + ":" + ticketID
+}
+
+func (s *Store) trackedSinceKey() string {
+	return s.prefix + ":tracked-since"
+}
+
+func (s *Store) Save(ctx context.Context, ticketID string, receiptNumber string) error {
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.key(ticketID), receiptNumber, s.ttl)
+		pipe.SetNX(ctx, s.trackedSinceKey(), time.Now().UnixMilli(), 0)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cannot save receipt of ticket %s: %w", ticketID, err)
+	}
+
+	return nil
+}
+
+// Get returns the receipt number of the ticket, or ErrNotFound if no receipt
+// was issued yet or it expired.
+func (s *Store) Get(ctx context.Context, ticketID string) (string, error) {
+	number, err := s.rdb.Get(ctx, s.key(ticketID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot get receipt of ticket %s: %w", ticketID, err)
+	}
+
+	return number, nil
+}
+
+// Kept reports whether the receipt of a ticket confirmed at confirmedAt is
+// kept, or will be once it's issued. Receipts of tickets confirmed before
+// the first receipt was saved, or longer than ttl ago, are not.
+func (s *Store) Kept(ctx context.Context, confirmedAt time.Time) (bool, error) {
+	if time.Since(confirmedAt) > s.ttl {
+		return false, nil
+	}
+
+	trackedSince, err := s.rdb.Get(ctx, s.trackedSinceKey()).Int64()
+	if errors.Is(err, redis.Nil) {
+		// No receipt was saved yet, the first ones may still be issued.
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot get when receipts were first tracked: %w", err)
+	}
+
+	return !confirmedAt.Before(time.UnixMilli(trackedSince)), nil
+}
@@ -0,0 +1,69 @@
+package receipts_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"tickets/receipts"
+)
+
+func TestStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store := receipts.NewStore(rdb, "receipts", time.Hour)
+	ctx := context.Background()
+
+	_, err := store.Get(ctx, "ticket-1")
+	assert.ErrorIs(t, err, receipts.ErrNotFound)
+
+	require.NoError(t, store.Save(ctx, "ticket-1", "receipt-1"))
+	require.NoError(t, store.Save(ctx, "ticket-2", "receipt-2"))
+
+	number, err := store.Get(ctx, "ticket-1")
+	require.NoError(t, err)
+	assert.Equal(t, "receipt-1", number)
+
+	mr.FastForward(time.Minute * 30)
+	require.NoError(t, store.Save(ctx, "ticket-2", "receipt-2"))
+	mr.FastForward(time.Minute * 31)
+
+	_, err = store.Get(ctx, "ticket-1")
+	assert.ErrorIs(t, err, receipts.ErrNotFound, "receipt should expire")
+
+	number, err = store.Get(ctx, "ticket-2")
+	require.NoError(t, err)
+	assert.Equal(t, "receipt-2", number, "receipts should expire on their own")
+}
+
+func TestStore_Kept(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store := receipts.NewStore(rdb, "receipts", time.Hour*24)
+	ctx := context.Background()
+
+	before := time.Now().Add(-time.Minute)
+
+	kept, err := store.Kept(ctx, before)
+	require.NoError(t, err)
+	assert.True(t, kept, "receipts may be issued before the first one is saved")
+
+	require.NoError(t, store.Save(ctx, "ticket-1", "receipt-1"))
+
+	kept, err = store.Kept(ctx, before)
+	require.NoError(t, err)
+	assert.False(t, kept, "confirmed before receipts were tracked")
+
+	kept, err = store.Kept(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.True(t, kept)
+
+	kept, err = store.Kept(ctx, time.Now().Add(-time.Hour*25))
+	require.NoError(t, err)
+	assert.False(t, kept, "expired")
+}
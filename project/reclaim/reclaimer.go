@@ -0,0 +1,263 @@
+package reclaim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/redis/go-redis/v9"
+)
+
+// Group is a consumer group of a stream.
+type Group struct {
+	Stream string
+	Name   string
+}
+
+type Config struct {
+	// Interval is how often pending entries are inspected.
+	Interval time.Duration
+	// MinIdle is how long an entry may stay pending before it is stuck.
+	MinIdle time.Duration
+	// ConsumerTimeout is how long a consumer may not read its stream before
+	// it is considered dead. It must be longer than the longest time a
+	// handler, with its retries, works on one message, because a consumer
+	// doesn't read while its handler runs.
+	ConsumerTimeout time.Duration
+	// BatchSize is how many pending entries are read at once.
+	BatchSize int64
+
+	// Observe, if not nil, is called after every inspection of a group.
+	Observe func(group Group, result Result)
+}
+
+func (c *Config) setDefaults() {
+	if c.Interval == 0 {
+		c.Interval = time.Second * 30
+	}
+	if c.MinIdle == 0 {
+		c.MinIdle = time.Minute
+	}
+	if c.ConsumerTimeout == 0 {
+		c.ConsumerTimeout = time.Minute * 10
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = 100
+	}
+}
+
+// Result of the inspection of a group.
+type Result struct {
+	// Stuck is the number of entries pending for longer than MinIdle.
+	Stuck int
+	// Reclaimed is the number of stuck entries moved from dead consumers to live ones.
+	Reclaimed int
+	// Orphaned is the number of stuck entries held by dead consumers, which
+	// couldn't be moved because the group has no live consumer.
+	Orphaned int
+}
+
+// Reclaimer moves entries pending at dead consumers, like those of a worker
+// which crashed mid-handler, to live consumers of the same group.
+//
+// Entries are moved as if they were delivered at the Unix epoch, before the
+// new owner started, so subscribers claiming the idle entries they were
+// delivered before they started redeliver them at their next claim
+// interval. Entries of live consumers are never moved, even when stuck, as
+// their handlers may still be working on them.
+type Reclaimer struct {
+	rdb    redis.UniversalClient
+	groups []Group
+	config Config
+	logger watermill.LoggerAdapter
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	running   sync.WaitGroup
+}
+
+func NewReclaimer(
+	rdb redis.UniversalClient,
+	groups []Group,
+	config Config,
+	logger watermill.LoggerAdapter,
+) *Reclaimer {
+	config.setDefaults()
+
+	return &Reclaimer{
+		rdb:     rdb,
+		groups:  groups,
+		config:  config,
+		logger:  logger,
+		closing: make(chan struct{}),
+	}
+}
+
+// Run reclaims entries every Interval until ctx is canceled or the
+// reclaimer is closed.
+func (r *Reclaimer) Run(ctx context.Context) error {
+	r.running.Add(1)
+	defer r.running.Done()
+
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.closing:
+			return nil
+		case <-ticker.C:
+		}
+
+		for _, group := range r.groups {
+			if r.isClosing() {
+				return nil
+			}
+
+			_, err := r.Reclaim(ctx, group)
+			if err != nil && ctx.Err() == nil {
+				r.logger.Error("Cannot reclaim pending entries", err, watermill.LogFields{
+					"stream": group.Stream,
+					"group":  group.Name,
+				})
+			}
+		}
+	}
+}
+
+// Close stops Run and waits until the group being inspected is done.
+func (r *Reclaimer) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closing)
+	})
+	r.running.Wait()
+
+	return nil
+}
+
+func (r *Reclaimer) isClosing() bool {
+	select {
+	case <-r.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reclaim inspects the pending entries of the group once.
+func (r *Reclaimer) Reclaim(ctx context.Context, group Group) (Result, error) {
+	result := Result{}
+
+	live, dead, err := r.consumers(ctx, group)
+	if err != nil {
+		return result, err
+	}
+	if dead == nil {
+		// The group doesn't exist yet, it's created by its first subscriber.
+		return result, nil
+	}
+
+	next := 0
+	start := "-"
+	for {
+		pending, err := r.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: group.Stream,
+			Group:  group.Name,
+			Idle:   r.config.MinIdle,
+			Start:  start,
+			End:    "+",
+			Count:  r.config.BatchSize,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return result, fmt.Errorf("cannot read pending entries of %s/%s: %w", group.Stream, group.Name, err)
+		}
+
+		for _, entry := range pending {
+			result.Stuck++
+
+			if !dead[entry.Consumer] {
+				continue
+			}
+			if len(live) == 0 {
+				result.Orphaned++
+				continue
+			}
+
+			consumer := live[next%len(live)]
+			next++
+
+			claimed, err := r.claim(ctx, group, consumer, entry)
+			if err != nil {
+				return result, err
+			}
+			if claimed {
+				result.Reclaimed++
+			}
+		}
+
+		if int64(len(pending)) < r.config.BatchSize {
+			break
+		}
+		start = "(" + pending[len(pending)-1].ID
+	}
+
+	if result.Orphaned > 0 {
+		r.logger.Info("Stuck entries have no live consumer to be reclaimed by", watermill.LogFields{
+			"stream":   group.Stream,
+			"group":    group.Name,
+			"orphaned": result.Orphaned,
+		})
+	}
+
+	if r.config.Observe != nil {
+		r.config.Observe(group, result)
+	}
+
+	return result, nil
+}
+
+// consumers returns the live consumers of the group and the set of the dead ones.
+func (r *Reclaimer) consumers(ctx context.Context, group Group) ([]string, map[string]bool, error) {
+	consumers, err := r.rdb.XInfoConsumers(ctx, group.Stream, group.Name).Result()
+	if err != nil {
+		if strings.Contains(err.Error(), "no such key") || strings.HasPrefix(err.Error(), "NOGROUP") {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("cannot get consumers of %s/%s: %w", group.Stream, group.Name, err)
+	}
+
+	var live []string
+	dead := map[string]bool{}
+	for _, c := range consumers {
+		if c.Idle >= 0 && c.Idle < r.config.ConsumerTimeout {
+			live = append(live, c.Name)
+		} else {
+			dead[c.Name] = true
+		}
+	}
+
+	return live, dead, nil
+}
+
+// claim moves the entry to the consumer, delivered at the Unix epoch. It
+// reports false when the entry is not pending anymore or was claimed meanwhile.
+func (r *Reclaimer) claim(ctx context.Context, group Group, consumer string, entry redis.XPendingExt) (bool, error) {
+	// go-redis doesn't support the TIME option of XCLAIM.
+	ids, err := r.rdb.Do(
+		ctx,
+		"XCLAIM", group.Stream, group.Name, consumer, entry.Idle.Milliseconds(), entry.ID,
+		"TIME", 0,
+		"JUSTID",
+	).StringSlice()
+	if err != nil {
+		return false, fmt.Errorf("cannot claim %s of %s/%s: %w", entry.ID, group.Stream, group.Name, err)
+	}
+
+	return len(ids) > 0, nil
+}
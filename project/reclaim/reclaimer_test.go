@@ -0,0 +1,201 @@
+package reclaim_test
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"tickets/reclaim"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var group = reclaim.Group{Stream: "TicketBookingConfirmed", Name: "issue-receipt"}
+
+type testRedis struct {
+	t   *testing.T
+	mr  *miniredis.Miniredis
+	rdb *redis.Client
+	now time.Time
+}
+
+// exclusiveRangeHook turns the exclusive starts of XPENDING ranges, which
+// miniredis doesn't support, into the next entry ID.
+type exclusiveRangeHook struct{}
+
+func (exclusiveRangeHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (exclusiveRangeHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == "xpending" {
+			args := cmd.Args()
+			for i, arg := range args {
+				id, ok := arg.(string)
+				if !ok || !strings.HasPrefix(id, "(") {
+					continue
+				}
+
+				ms, seq, _ := strings.Cut(strings.TrimPrefix(id, "("), "-")
+				n, err := strconv.ParseUint(seq, 10, 64)
+				if err != nil {
+					return err
+				}
+				args[i] = ms + "-" + strconv.FormatUint(n+1, 10)
+			}
+		}
+
+		return next(ctx, cmd)
+	}
+}
+
+func (exclusiveRangeHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func newTestRedis(t *testing.T) *testRedis {
+	mr := miniredis.RunT(t)
+	tr := &testRedis{
+		t:   t,
+		mr:  mr,
+		rdb: redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		now: time.Now(),
+	}
+	tr.rdb.AddHook(exclusiveRangeHook{})
+	mr.SetTime(tr.now)
+
+	err := tr.rdb.XGroupCreateMkStream(context.Background(), group.Stream, group.Name, "0").Err()
+	require.NoError(t, err)
+
+	return tr
+}
+
+func (tr *testRedis) advance(d time.Duration) {
+	tr.now = tr.now.Add(d)
+	tr.mr.SetTime(tr.now)
+}
+
+// deliver adds count entries to the stream and delivers them to the consumer.
+func (tr *testRedis) deliver(consumer string, count int) {
+	ctx := context.Background()
+	for i := 0; i < count; i++ {
+		err := tr.rdb.XAdd(ctx, &redis.XAddArgs{Stream: group.Stream, Values: map[string]any{"payload": "{}"}}).Err()
+		require.NoError(tr.t, err)
+	}
+
+	err := tr.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group.Name,
+		Consumer: consumer,
+		Streams:  []string{group.Stream, ">"},
+		Count:    int64(count),
+		Block:    -1,
+	}).Err()
+	require.NoError(tr.t, err)
+
+	// miniredis updates the idle time of consumers only on XCLAIM, unlike
+	// Redis which updates it on every read.
+	err = tr.rdb.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   group.Stream,
+		Group:    group.Name,
+		Consumer: consumer,
+		Messages: []string{"0-1"},
+	}).Err()
+	require.NoError(tr.t, err)
+}
+
+func (tr *testRedis) pending() map[string][]time.Duration {
+	entries, err := tr.rdb.XPendingExt(context.Background(), &redis.XPendingExtArgs{
+		Stream: group.Stream,
+		Group:  group.Name,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+	}).Result()
+	require.NoError(tr.t, err)
+
+	byConsumer := map[string][]time.Duration{}
+	for _, e := range entries {
+		byConsumer[e.Consumer] = append(byConsumer[e.Consumer], e.Idle)
+	}
+	return byConsumer
+}
+
+func TestReclaimer_reclaim(t *testing.T) {
+	tr := newTestRedis(t)
+
+	// The crashed consumer holds two entries, the live one is busy with a third one.
+	tr.deliver("crashed", 2)
+	tr.deliver("live", 1)
+
+	tr.advance(time.Minute * 11)
+	// The live consumer keeps reading, the crashed one doesn't.
+	tr.deliver("live", 1)
+
+	var observed []reclaim.Result
+	reclaimer := reclaim.NewReclaimer(tr.rdb, []reclaim.Group{group}, reclaim.Config{
+		MinIdle:         time.Minute,
+		ConsumerTimeout: time.Minute * 10,
+		BatchSize:       1,
+		Observe: func(g reclaim.Group, result reclaim.Result) {
+			assert.Equal(t, group, g)
+			observed = append(observed, result)
+		},
+	}, watermill.NopLogger{})
+
+	result, err := reclaimer.Reclaim(context.Background(), group)
+	require.NoError(t, err)
+
+	want := reclaim.Result{Stuck: 3, Reclaimed: 2}
+	assert.Equal(t, want, result)
+	assert.Equal(t, []reclaim.Result{want}, observed)
+
+	pending := tr.pending()
+	assert.Empty(t, pending["crashed"])
+	// Reclaimed entries look delivered at the Unix epoch, before the live
+	// consumer started, so it claims them right away, unlike its own ones.
+	require.Len(t, pending["live"], 4)
+	for _, idle := range pending["live"][:2] {
+		assert.Greater(t, idle, tr.now.Sub(time.Unix(0, 0))-time.Hour)
+	}
+	for _, idle := range pending["live"][2:] {
+		assert.LessOrEqual(t, idle, time.Minute*11)
+	}
+
+	// Nothing is left to reclaim, but the entries stay stuck until they're handled.
+	result, err = reclaimer.Reclaim(context.Background(), group)
+	require.NoError(t, err)
+	assert.Equal(t, reclaim.Result{Stuck: 3}, result)
+}
+
+func TestReclaimer_no_live_consumer(t *testing.T) {
+	tr := newTestRedis(t)
+
+	tr.deliver("crashed", 2)
+	tr.advance(time.Minute * 11)
+
+	reclaimer := reclaim.NewReclaimer(tr.rdb, []reclaim.Group{group}, reclaim.Config{
+		MinIdle:         time.Minute,
+		ConsumerTimeout: time.Minute * 10,
+	}, watermill.NopLogger{})
+
+	result, err := reclaimer.Reclaim(context.Background(), group)
+	require.NoError(t, err)
+	assert.Equal(t, reclaim.Result{Stuck: 2, Orphaned: 2}, result)
+	assert.Len(t, tr.pending()["crashed"], 2)
+}
+
+func TestReclaimer_missing_group(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+
+	reclaimer := reclaim.NewReclaimer(rdb, []reclaim.Group{group}, reclaim.Config{}, watermill.NopLogger{})
+
+	result, err := reclaimer.Reclaim(context.Background(), group)
+	require.NoError(t, err)
+	assert.Equal(t, reclaim.Result{}, result)
+}
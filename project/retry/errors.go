@@ -0,0 +1,63 @@
+package retry
+
+import (
+	"errors"
+	"time"
+)
+
+// Retryable is implemented by errors which know whether retrying can help.
+type Retryable interface {
+	error
+	Retryable() bool
+}
+
+// Delayer is implemented by errors which tell how long to wait before the
+// next attempt, like rate limiting with Retry-After.
+type Delayer interface {
+	error
+	RetryDelay() time.Duration
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+func (e permanentError) Retryable() bool {
+	return false
+}
+
+// Permanent marks err as one which retrying won't fix.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var retryable Retryable
+	if errors.As(err, &retryable) {
+		return !retryable.Retryable()
+	}
+
+	return false
+}
+
+// Delay returns the delay requested by err, or 0 if it didn't request any.
+func Delay(err error) time.Duration {
+	var delayer Delayer
+	if errors.As(err, &delayer) {
+		return delayer.RetryDelay()
+	}
+
+	return 0
+}
@@ -0,0 +1,30 @@
+package retry_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"tickets/retry"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type throttledError struct {
+	delay time.Duration
+}
+
+func (e throttledError) Error() string             { return "throttled" }
+func (e throttledError) Retryable() bool           { return true }
+func (e throttledError) RetryDelay() time.Duration { return e.delay }
+
+func TestClassification(t *testing.T) {
+	wrapped := fmt.Errorf("cannot issue receipt: %w", throttledError{delay: time.Second})
+
+	assert.False(t, retry.IsPermanent(wrapped))
+	assert.Equal(t, time.Second, retry.Delay(wrapped))
+
+	assert.True(t, retry.IsPermanent(fmt.Errorf("handler: %w", retry.Permanent(errors.New("invalid")))))
+	assert.False(t, retry.IsPermanent(errors.New("timeout")))
+	assert.Zero(t, retry.Delay(errors.New("timeout")))
+}
@@ -0,0 +1,117 @@
+package retry
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+type Policy struct {
+	// MaxAttempts limits how many times the handler is called, 0 means no limit.
+	MaxAttempts int
+	// InitialInterval is the delay before the first retry.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between retries.
+	MaxInterval time.Duration
+	// Multiplier is applied to the delay after each retry.
+	Multiplier float64
+	// Jitter randomizes each delay by up to the given fraction, e.g. 0.2 for ±20%.
+	Jitter float64
+	// MaxElapsedTime stops retrying once it passed since the first attempt, 0 means no limit.
+	MaxElapsedTime time.Duration
+}
+
+func (p Policy) delay(interval time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return interval
+	}
+
+	delta := p.Jitter * float64(interval)
+	return time.Duration(float64(interval) - delta + rand.Float64()*2*delta)
+}
+
+func (p Policy) next(interval time.Duration) time.Duration {
+	if p.Multiplier > 0 {
+		interval = time.Duration(float64(interval) * p.Multiplier)
+	}
+	if p.MaxInterval > 0 && interval > p.MaxInterval {
+		interval = p.MaxInterval
+	}
+
+	return interval
+}
+
+// Middleware retries failed messages with the policy of the handler
+// handling them. Errors marked with Permanent, or implementing Retryable
+// and reporting false, are not retried. Errors implementing Delayer can
+// extend the delay before the next attempt.
+type Middleware struct {
+	Default  Policy
+	Handlers map[string]Policy
+	Logger   watermill.LoggerAdapter
+}
+
+func (m Middleware) policy(handlerName string) Policy {
+	if policy, ok := m.Handlers[handlerName]; ok {
+		return policy
+	}
+
+	return m.Default
+}
+
+func (m Middleware) Middleware(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		ctx := msg.Context()
+		handlerName := message.HandlerNameFromCtx(ctx)
+		policy := m.policy(handlerName)
+
+		start := time.Now()
+		interval := policy.InitialInterval
+
+		for attempt := 1; ; attempt++ {
+			msgs, err := h(msg)
+			if err == nil {
+				return msgs, nil
+			}
+
+			fields := watermill.LogFields{
+				"handler":      handlerName,
+				"message_uuid": msg.UUID,
+				"attempt":      attempt,
+			}
+
+			if IsPermanent(err) {
+				m.Logger.Error("Permanent error, not retrying", err, fields)
+				return msgs, err
+			}
+			if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+				m.Logger.Error("Max attempts reached", err, fields)
+				return msgs, err
+			}
+
+			delay := policy.delay(interval)
+			if requested := Delay(err); requested > delay {
+				delay = requested
+			}
+			if policy.MaxElapsedTime > 0 && time.Since(start)+delay > policy.MaxElapsedTime {
+				m.Logger.Error("Max elapsed time reached", err, fields)
+				return msgs, err
+			}
+
+			m.Logger.Info("Retrying message", fields.Add(watermill.LogFields{
+				"error": err.Error(),
+				"delay": delay,
+			}))
+
+			select {
+			case <-ctx.Done():
+				return msgs, err
+			case <-time.After(delay):
+			}
+
+			interval = policy.next(interval)
+		}
+	}
+}
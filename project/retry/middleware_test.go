@@ -0,0 +1,138 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"tickets/retry"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	testCases := []struct {
+		name             string
+		handler          string
+		err              error
+		expectedAttempts int32
+	}{
+		{
+			name:             "transient_error_uses_handler_policy",
+			handler:          "limited",
+			err:              errors.New("service unavailable"),
+			expectedAttempts: 3,
+		},
+		{
+			name:             "transient_error_uses_default_policy",
+			handler:          "other",
+			err:              errors.New("service unavailable"),
+			expectedAttempts: 5,
+		},
+		{
+			name:             "permanent_error_fails_fast",
+			handler:          "limited",
+			err:              retry.Permanent(errors.New("bad request")),
+			expectedAttempts: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := watermill.NopLogger{}
+			pubSub := gochannel.NewGoChannel(gochannel.Config{}, logger)
+
+			router, err := message.NewRouter(message.RouterConfig{}, logger)
+			require.NoError(t, err)
+
+			var failed atomic.Bool
+			router.AddMiddleware(func(h message.HandlerFunc) message.HandlerFunc {
+				return func(msg *message.Message) ([]*message.Message, error) {
+					msgs, err := h(msg)
+					if err != nil {
+						failed.Store(true)
+					}
+					// Ack anyway, so the message is not redelivered.
+					return msgs, nil
+				}
+			})
+			router.AddMiddleware(retry.Middleware{
+				Default: retry.Policy{MaxAttempts: 5, InitialInterval: time.Millisecond},
+				Handlers: map[string]retry.Policy{
+					"limited": {MaxAttempts: 3, InitialInterval: time.Millisecond, Multiplier: 2, Jitter: 0.5},
+				},
+				Logger: logger,
+			}.Middleware)
+
+			var attempts atomic.Int32
+			router.AddNoPublisherHandler(tc.handler, "topic", pubSub, func(msg *message.Message) error {
+				attempts.Add(1)
+				return tc.err
+			})
+
+			go func() {
+				_ = router.Run(context.Background())
+			}()
+			t.Cleanup(func() {
+				_ = router.Close()
+			})
+			<-router.Running()
+
+			require.NoError(t, pubSub.Publish("topic", message.NewMessage(watermill.NewUUID(), nil)))
+
+			assert.Eventually(t, failed.Load, time.Second*5, time.Millisecond*10)
+			assert.Equal(t, tc.expectedAttempts, attempts.Load())
+		})
+	}
+}
+
+func TestMiddleware_max_elapsed_time(t *testing.T) {
+	logger := watermill.NopLogger{}
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, logger)
+
+	router, err := message.NewRouter(message.RouterConfig{}, logger)
+	require.NoError(t, err)
+
+	done := make(chan time.Duration, 1)
+	router.AddMiddleware(func(h message.HandlerFunc) message.HandlerFunc {
+		return func(msg *message.Message) ([]*message.Message, error) {
+			start := time.Now()
+			_, _ = h(msg)
+			done <- time.Since(start)
+			return nil, nil
+		}
+	})
+	router.AddMiddleware(retry.Middleware{
+		Default: retry.Policy{
+			InitialInterval: time.Millisecond * 20,
+			MaxElapsedTime:  time.Millisecond * 100,
+		},
+		Logger: logger,
+	}.Middleware)
+
+	router.AddNoPublisherHandler("handler", "topic", pubSub, func(msg *message.Message) error {
+		return errors.New("service unavailable")
+	})
+
+	go func() {
+		_ = router.Run(context.Background())
+	}()
+	t.Cleanup(func() {
+		_ = router.Close()
+	})
+	<-router.Running()
+
+	require.NoError(t, pubSub.Publish("topic", message.NewMessage(watermill.NewUUID(), nil)))
+
+	select {
+	case elapsed := <-done:
+		assert.Less(t, elapsed, time.Millisecond*150)
+	case <-time.After(time.Second * 5):
+		t.Fatal("retries did not stop after max elapsed time")
+	}
+}
@@ -0,0 +1,45 @@
+package tickets
+
+// The ticket lifecycle is confirmed → canceled, following the booking
+// events. The empty status is a ticket nothing is known about yet, which
+// stands for a pending booking. There is no refunded status: refunds are
+// made by hand from the tickets-to-refund spreadsheet, and no event or
+// request reports them.
+var transitions = map[Status][]Status{
+	"":              {StatusConfirmed},
+	StatusConfirmed: {StatusCanceled},
+}
+
+// stages orders statuses along the lifecycle.
+var stages = map[Status]int{
+	"":              0,
+	StatusConfirmed: 1,
+	StatusCanceled:  2,
+}
+
+// CanTransition reports whether a ticket can move from status from to status to.
+func CanTransition(from, to Status) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Ahead reports whether status to cannot be reached from status from yet,
+// but may be once the statuses in between are reached. A status that is
+// neither reachable nor ahead is an illegal transition.
+func Ahead(from, to Status) bool {
+	fromStage, ok := stages[from]
+	if !ok {
+		return false
+	}
+	toStage, ok := stages[to]
+	if !ok {
+		return false
+	}
+
+	return !CanTransition(from, to) && fromStage < toStage
+}
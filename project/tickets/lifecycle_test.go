@@ -0,0 +1,33 @@
+package tickets_test
+
+import (
+	"testing"
+	"tickets/tickets"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycle(t *testing.T) {
+	testCases := []struct {
+		from    tickets.Status
+		to      tickets.Status
+		allowed bool
+		ahead   bool
+	}{
+		{from: "", to: tickets.StatusConfirmed, allowed: true},
+		{from: "", to: tickets.StatusCanceled, ahead: true},
+		{from: tickets.StatusConfirmed, to: tickets.StatusCanceled, allowed: true},
+		{from: tickets.StatusConfirmed, to: tickets.StatusConfirmed},
+		{from: tickets.StatusCanceled, to: tickets.StatusConfirmed},
+		{from: tickets.StatusCanceled, to: tickets.StatusCanceled},
+		{from: "", to: "refunded"},
+		{from: tickets.StatusConfirmed, to: "refunded"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.from)+"_to_"+string(tc.to), func(t *testing.T) {
+			assert.Equal(t, tc.allowed, tickets.CanTransition(tc.from, tc.to))
+			assert.Equal(t, tc.ahead, tickets.Ahead(tc.from, tc.to))
+		})
+	}
+}
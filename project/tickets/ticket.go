@@ -1,13 +1,28 @@
 package tickets
 
-type Price struct {
-	Amount   string `json:"amount"`
-	Currency string `json:"currency"`
+import "tickets/money"
+
+type Status string
+
+const (
+	StatusConfirmed Status = "confirmed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Valid reports whether the status can be reported by the tickets status webhook.
+func (s Status) Valid() bool {
+	return s == StatusConfirmed || s == StatusCanceled
+}
+
+// Known reports whether the status is part of the ticket lifecycle.
+func (s Status) Known() bool {
+	_, ok := stages[s]
+	return ok && s != ""
 }
 
 type Ticket struct {
-	TicketId      string `json:"ticket_id"`
-	Status        string `json:"status"`
-	CustomerEmail string `json:"customer_email"`
-	Price         Price  `json:"price"`
+	TicketId      string      `json:"ticket_id"`
+	Status        Status      `json:"status"`
+	CustomerEmail string      `json:"customer_email"`
+	Price         money.Money `json:"price"`
 }
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"fmt"
+
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a consumer span for every handled message, continuing
+// the trace propagated in the message metadata.
+func Middleware(next message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		ctx := Extract(msg.Context(), propagation.MapCarrier(msg.Metadata))
+
+		topic := message.SubscribeTopicFromCtx(ctx)
+		ctx, span := Tracer().Start(
+			ctx,
+			fmt.Sprintf("%s %s", message.HandlerNameFromCtx(ctx), topic),
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("messaging.destination.name", topic),
+				attribute.String("messaging.message.id", msg.UUID),
+			),
+		)
+		defer span.End()
+
+		msg.SetContext(ctx)
+
+		msgs, err := next(msg)
+		RecordError(span, err)
+
+		return msgs, err
+	}
+}
+
+// EchoMiddleware starts a server span for every request, continuing the
+// trace propagated in the request headers.
+func EchoMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+		ctx, span := Tracer().Start(
+			ctx,
+			fmt.Sprintf("%s %s", req.Method, c.Path()),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", req.Method),
+				attribute.String("http.route", c.Path()),
+			),
+		)
+		defer span.End()
+
+		c.SetRequest(req.WithContext(ctx))
+
+		err := next(c)
+		RecordError(span, err)
+		span.SetAttributes(attribute.Int("http.response.status_code", c.Response().Status))
+
+		return err
+	}
+}
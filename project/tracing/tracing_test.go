@@ -0,0 +1,84 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+	"tickets/eventbus"
+	"tickets/events"
+	"tickets/tracing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceIsPropagatedThroughMessages(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracing.Install(tp)
+
+	logger := watermill.NopLogger{}
+	pubSub := gochannel.NewGoChannel(gochannel.Config{}, logger)
+
+	router, err := message.NewRouter(message.RouterConfig{}, logger)
+	require.NoError(t, err)
+	router.AddMiddleware(tracing.Middleware)
+
+	processor := eventbus.NewProcessor(router, func(handlerName string) (message.Subscriber, error) {
+		return pubSub, nil
+	}, events.NewUpcasters(), 1)
+
+	handled := make(chan trace.SpanContext, 1)
+	err = eventbus.AddHandler(processor, "issue-receipt-handler", func(ctx context.Context, event *events.TicketBookingConfirmed) error {
+		handled <- trace.SpanContextFromContext(ctx)
+		return nil
+	})
+	require.NoError(t, err)
+
+	go func() {
+		_ = router.Run(context.Background())
+	}()
+	t.Cleanup(func() {
+		_ = router.Close()
+	})
+	<-router.Running()
+
+	ctx, requestSpan := tp.Tracer("test").Start(context.Background(), "POST /tickets-status")
+	err = eventbus.Publish(ctx, eventbus.NewBus(pubSub, 1), events.TicketBookingConfirmed{
+		Header:   events.NewHeader[events.TicketBookingConfirmed](),
+		TicketId: "ticket-1",
+	})
+	require.NoError(t, err)
+	requestSpan.End()
+
+	var consumerSpan trace.SpanContext
+	select {
+	case consumerSpan = <-handled:
+	case <-time.After(time.Second * 5):
+		t.Fatal("message was not handled")
+	}
+
+	assert.Equal(t, requestSpan.SpanContext().TraceID(), consumerSpan.TraceID())
+
+	spans := map[string]tracetest.SpanStub{}
+	assert.Eventually(t, func() bool {
+		for _, span := range exporter.GetSpans() {
+			spans[span.Name] = span
+		}
+		_, ok := spans["issue-receipt-handler TicketBookings"]
+		return ok
+	}, time.Second*5, time.Millisecond*10)
+
+	producer := spans["publish TicketBookings"]
+	consumer := spans["issue-receipt-handler TicketBookings"]
+
+	assert.Equal(t, requestSpan.SpanContext().SpanID(), producer.Parent.SpanID())
+	assert.Equal(t, producer.SpanContext.SpanID(), consumer.Parent.SpanID())
+	assert.Equal(t, trace.SpanKindConsumer, consumer.SpanKind)
+}